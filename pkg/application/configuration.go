@@ -122,6 +122,19 @@ func (c *Configuration) SetFile(name string, v *viper.Viper) error {
 	return v.ReadInConfig()
 }
 
+// Reload reads all registered configuration files from disk again
+func (c *Configuration) Reload() error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	for _, v := range c.files {
+		if err := v.ReadInConfig(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (c *Configuration) EnvExists(name string) bool {
 	c.mux.Lock()
 	defer c.mux.Unlock()
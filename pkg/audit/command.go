@@ -0,0 +1,63 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package audit
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/corelayer/go-kit/pkg/application"
+)
+
+// NewCommand returns an "audit" command with a "verify" subcommand checking the audit log at path for tampering,
+// using the key read from keyFile
+func NewCommand(path string, keyFile string) application.Command {
+	var file, key string
+
+	return application.Command{
+		Root: &cobra.Command{
+			Use:   "audit",
+			Short: "Manage the audit log",
+		},
+		Configure: func(cmd *cobra.Command) {
+			cmd.PersistentFlags().StringVar(&file, "file", path, "path to the audit log")
+			cmd.PersistentFlags().StringVar(&key, "key-file", keyFile, "path to the file containing the key of the audit log")
+		},
+		SubCommands: []application.Commander{
+			application.Command{
+				Root: &cobra.Command{
+					Use:   "verify",
+					Short: "Verify the hash chain of the audit log",
+					Args:  cobra.NoArgs,
+					RunE: func(cmd *cobra.Command, args []string) error {
+						k, err := ReadKey(key)
+						if err != nil {
+							return err
+						}
+						count, err := Verify(file, k)
+						if err != nil {
+							return err
+						}
+						_, err = fmt.Fprintf(cmd.OutOrStdout(), "verified %d records\n", count)
+						return err
+					},
+				},
+			},
+		},
+	}
+}
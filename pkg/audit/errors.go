@@ -0,0 +1,63 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package audit
+
+const (
+	ErrChainBrokenMessage   = "audit log hash chain is broken"
+	ErrKeyMissingMessage    = "audit log key is missing"
+	ErrRecordInvalidMessage = "audit log record is invalid"
+	ErrWriterClosedMessage  = "audit log writer is closed"
+)
+
+var (
+	ErrChainBroken   = ChainBrokenError{message: ErrChainBrokenMessage}
+	ErrKeyMissing    = KeyMissingError{message: ErrKeyMissingMessage}
+	ErrRecordInvalid = RecordInvalidError{message: ErrRecordInvalidMessage}
+	ErrWriterClosed  = WriterClosedError{message: ErrWriterClosedMessage}
+)
+
+type ChainBrokenError struct {
+	message string
+}
+
+func (e ChainBrokenError) Error() string {
+	return e.message
+}
+
+type KeyMissingError struct {
+	message string
+}
+
+func (e KeyMissingError) Error() string {
+	return e.message
+}
+
+type RecordInvalidError struct {
+	message string
+}
+
+func (e RecordInvalidError) Error() string {
+	return e.message
+}
+
+type WriterClosedError struct {
+	message string
+}
+
+func (e WriterClosedError) Error() string {
+	return e.message
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package audit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+type Outcome string
+
+const (
+	OutcomeSuccess Outcome = "success"
+	OutcomeDenied  Outcome = "denied"
+	OutcomeFailure Outcome = "failure"
+)
+
+// Record is a single line in the audit log.
+// Hash is the HMAC-SHA-256 of PreviousHash and the JSON encoding of the record without Hash, keyed with the key of the log.
+// It chains every record to its predecessor, the chain cannot be recomputed after modifying records without the key.
+type Record struct {
+	Sequence     uint64          `json:"sequence"`
+	Time         time.Time       `json:"time"`
+	Principal    string          `json:"principal"`
+	Method       string          `json:"method"`
+	Route        string          `json:"route"`
+	Path         string          `json:"path"`
+	RemoteAddr   string          `json:"remoteAddr,omitempty"`
+	Body         json.RawMessage `json:"body,omitempty"`
+	Status       int             `json:"status"`
+	Outcome      Outcome         `json:"outcome"`
+	Latency      time.Duration   `json:"latency"`
+	PreviousHash string          `json:"previousHash"`
+	Hash         string          `json:"hash,omitempty"`
+}
+
+func (r Record) computeHash(key []byte) (string, error) {
+	r.Hash = ""
+	content, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(r.PreviousHash))
+	h.Write(content)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
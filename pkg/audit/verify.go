@@ -0,0 +1,100 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package audit
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Verify checks the hash chain of the audit log at path and its rotated files with the key the log was written with,
+// it returns the number of verified records. Modified, inserted, reordered or removed records between the first and
+// last record present, or records written with another key, result in an error wrapping ErrChainBroken or
+// ErrRecordInvalid. Records removed from the start of the oldest file or the end of the newest file are not detected,
+// compare the returned count or the hash of the last record with a value kept elsewhere to detect those.
+func Verify(path string, key []byte) (int, error) {
+	if len(key) == 0 {
+		return 0, ErrKeyMissing
+	}
+
+	files, err := LogFiles(path)
+	if err != nil {
+		return 0, err
+	}
+	if len(files) == 0 {
+		return 0, os.ErrNotExist
+	}
+
+	var (
+		count        int
+		first        = true
+		sequence     uint64
+		previousHash string
+	)
+	for _, name := range files {
+		var file *os.File
+		if file, err = os.Open(name); err != nil {
+			return count, err
+		}
+
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+		line := 0
+		for scanner.Scan() {
+			line++
+			if len(scanner.Bytes()) == 0 {
+				continue
+			}
+
+			var r Record
+			if err = json.Unmarshal(scanner.Bytes(), &r); err != nil {
+				_ = file.Close()
+				return count, fmt.Errorf("%s:%d: %w", name, line, ErrRecordInvalid)
+			}
+
+			// Older records may have been archived, the chain is verified from the first record present
+			if !first && (r.Sequence != sequence+1 || r.PreviousHash != previousHash) {
+				_ = file.Close()
+				return count, fmt.Errorf("%s:%d: record %d does not follow record %d: %w", name, line, r.Sequence, sequence, ErrChainBroken)
+			}
+
+			var hash string
+			if hash, err = r.computeHash(key); err != nil {
+				_ = file.Close()
+				return count, err
+			}
+			if !hmac.Equal([]byte(hash), []byte(r.Hash)) {
+				_ = file.Close()
+				return count, fmt.Errorf("%s:%d: record %d hash mismatch: %w", name, line, r.Sequence, ErrChainBroken)
+			}
+
+			first = false
+			sequence = r.Sequence
+			previousHash = r.Hash
+			count++
+		}
+		err = scanner.Err()
+		_ = file.Close()
+		if err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,193 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+package audit
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testKey = []byte("audit-test-key")
+
+func writeLog(t *testing.T, path string, maxSize int64, count int) {
+	t.Helper()
+
+	w, err := NewWriter(path, maxSize, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < count; i++ {
+		if err = w.Write(Record{Principal: "alice", Method: "POST", Route: "/items", Path: "/items", Status: 201, Outcome: OutcomeSuccess}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(lines []string) []string
+		key    []byte
+		count  int
+		err    error
+	}{
+		{
+			name:   "unmodified log",
+			modify: func(lines []string) []string { return lines },
+			key:    testKey,
+			count:  5,
+		},
+		{
+			name: "oldest records archived",
+			modify: func(lines []string) []string {
+				return lines[2:]
+			},
+			key:   testKey,
+			count: 3,
+		},
+		{
+			name: "modified record",
+			modify: func(lines []string) []string {
+				lines[2] = strings.Replace(lines[2], `"principal":"alice"`, `"principal":"mallory"`, 1)
+				return lines
+			},
+			key: testKey,
+			err: ErrChainBroken,
+		},
+		{
+			name: "removed record",
+			modify: func(lines []string) []string {
+				return append(lines[:2], lines[3:]...)
+			},
+			key: testKey,
+			err: ErrChainBroken,
+		},
+		{
+			name: "reordered records",
+			modify: func(lines []string) []string {
+				lines[1], lines[2] = lines[2], lines[1]
+				return lines
+			},
+			key: testKey,
+			err: ErrChainBroken,
+		},
+		{
+			name: "invalid record",
+			modify: func(lines []string) []string {
+				lines[3] = "{"
+				return lines
+			},
+			key: testKey,
+			err: ErrRecordInvalid,
+		},
+		{
+			name:   "other key",
+			modify: func(lines []string) []string { return lines },
+			key:    []byte("other-key"),
+			err:    ErrChainBroken,
+		},
+		{
+			name:   "missing key",
+			modify: func(lines []string) []string { return lines },
+			err:    ErrKeyMissing,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "audit.jsonl")
+			writeLog(t, path, 0, 5)
+
+			content, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := tt.modify(strings.Split(strings.TrimSuffix(string(content), "\n"), "\n"))
+			if err = os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			count, err := Verify(path, tt.key)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if tt.err == nil && count != tt.count {
+				t.Errorf("expected %d records, got %d", tt.count, count)
+			}
+		})
+	}
+}
+
+func TestVerifyRotatedLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	writeLog(t, path, 512, 3)
+	// A reopened writer continues the chain of the existing log
+	writeLog(t, path, 512, 3)
+
+	files, err := LogFiles(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) < 3 {
+		t.Fatalf("expected at least 3 files, got %v", files)
+	}
+
+	count, err := Verify(path, testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 6 {
+		t.Errorf("expected 6 records, got %d", count)
+	}
+
+	// Removing a rotated file between others breaks the chain
+	if err = os.Remove(files[1]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Verify(path, testKey); !errors.Is(err, ErrChainBroken) {
+		t.Errorf("expected %v, got %v", ErrChainBroken, err)
+	}
+}
+
+func TestReadKey(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "key")
+	if err := os.WriteFile(path, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	key, err := ReadKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(key, []byte("secret")) {
+		t.Errorf("expected key %q, got %q", "secret", key)
+	}
+
+	empty := filepath.Join(dir, "empty")
+	if err = os.WriteFile(empty, []byte("\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ReadKey(empty); !errors.Is(err, ErrKeyMissing) {
+		t.Errorf("expected %v, got %v", ErrKeyMissing, err)
+	}
+}
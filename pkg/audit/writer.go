@@ -0,0 +1,278 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/corelayer/go-kit/pkg/pathutils"
+	"github.com/corelayer/go-kit/pkg/timestamp"
+)
+
+// NewWriter opens the audit log at path for appending, the chain continues from the last record of the existing log.
+// Records are chained with an HMAC keyed with key, which is required to verify the log and must be kept secret.
+// When the log grows beyond maxSize bytes, it is renamed with a timestamp suffix and a new file is started, 0 disables rotation.
+func NewWriter(path string, maxSize int64, key []byte) (*Writer, error) {
+	var (
+		err          error
+		expandedPath string
+	)
+
+	if len(key) == 0 {
+		return nil, ErrKeyMissing
+	}
+
+	if expandedPath, err = pathutils.GetExpandedPath(path); err != nil {
+		return nil, err
+	}
+	if err = pathutils.CreateDirectory(filepath.Dir(expandedPath), 0700); err != nil {
+		return nil, err
+	}
+
+	w := &Writer{
+		path:    expandedPath,
+		maxSize: maxSize,
+		key:     key,
+	}
+
+	var files []string
+	if files, err = LogFiles(expandedPath); err != nil {
+		return nil, err
+	}
+	// The active log may be empty after a rotation, continue from the last record of the newest file
+	for i := len(files) - 1; i >= 0; i-- {
+		var last *Record
+		if last, err = lastRecord(files[i]); err != nil {
+			return nil, err
+		}
+		if last != nil {
+			w.sequence = last.Sequence
+			w.previousHash = last.Hash
+			break
+		}
+	}
+
+	if err = w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// ReadKey returns the key stored in the file at path, surrounding whitespace is ignored
+func ReadKey(path string) ([]byte, error) {
+	expandedPath, err := pathutils.GetExpandedPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var content []byte
+	if content, err = os.ReadFile(expandedPath); err != nil {
+		return nil, err
+	}
+	if content = bytes.TrimSpace(content); len(content) == 0 {
+		return nil, ErrKeyMissing
+	}
+	return content, nil
+}
+
+// Writer appends hash-chained records to a JSON lines audit log, every record is synced to disk before Write returns
+type Writer struct {
+	path         string
+	maxSize      int64
+	key          []byte
+	file         *os.File
+	size         int64
+	sequence     uint64
+	previousHash string
+	mux          sync.Mutex
+}
+
+func (w *Writer) Write(r Record) error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.file == nil {
+		return ErrWriterClosed
+	}
+
+	r.Sequence = w.sequence + 1
+	r.PreviousHash = w.previousHash
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	r.Time = r.Time.UTC()
+
+	var err error
+	if r.Hash, err = r.computeHash(w.key); err != nil {
+		return err
+	}
+
+	var line []byte
+	if line, err = json.Marshal(r); err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	if w.maxSize > 0 && w.size > 0 && w.size+int64(len(line)) > w.maxSize {
+		if err = w.rotate(); err != nil {
+			return err
+		}
+	}
+
+	var n int
+	n, err = w.file.Write(line)
+	w.size += int64(n)
+	if err != nil {
+		return err
+	}
+	if err = w.file.Sync(); err != nil {
+		return err
+	}
+
+	w.sequence = r.Sequence
+	w.previousHash = r.Hash
+	return nil
+}
+
+func (w *Writer) Close() error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+func (w *Writer) open() error {
+	file, err := os.OpenFile(w.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+
+	var info os.FileInfo
+	if info, err = file.Stat(); err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	w.file = file
+	w.size = info.Size()
+	return nil
+}
+
+func (w *Writer) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	w.file = nil
+
+	if err := os.Rename(w.path, rotatedName(w.path)); err != nil {
+		return err
+	}
+	return w.open()
+}
+
+// rotatedName returns path with a UTC timestamp suffix, e.g. audit-20240102_150405.jsonl, which sorts in rotation order
+// regardless of the local time zone and daylight saving time
+func rotatedName(path string) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext) + "-" + timestamp.Format(time.Now().UTC())
+
+	name := base + ext
+	for i := 1; ; i++ {
+		if _, err := os.Stat(name); os.IsNotExist(err) {
+			return name
+		}
+		name = fmt.Sprintf("%s_%03d%s", base, i, ext)
+	}
+}
+
+// rotatedSuffix matches the suffix added by rotatedName, so logs sharing a prefix such as audit-admin.jsonl are ignored
+var rotatedSuffix = regexp.MustCompile(`^-\d{8}_\d{6}(_\d{3,})?$`)
+
+// LogFiles returns the rotated files of the audit log at path in rotation order, followed by path itself when it exists
+func LogFiles(path string) ([]string, error) {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	candidates, err := filepath.Glob(globEscape(base) + "-*" + ext)
+	if err != nil {
+		return nil, err
+	}
+
+	rotated := make([]string, 0, len(candidates))
+	for _, name := range candidates {
+		if rotatedSuffix.MatchString(strings.TrimSuffix(strings.TrimPrefix(name, base), ext)) {
+			rotated = append(rotated, name)
+		}
+	}
+	sort.Strings(rotated)
+
+	if _, err = os.Stat(path); err == nil {
+		rotated = append(rotated, path)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return rotated, nil
+}
+
+func lastRecord(path string) (*Record, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var last []byte
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) > 0 {
+			last = append(last[:0], scanner.Bytes()...)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	if last == nil {
+		return nil, nil
+	}
+
+	var r Record
+	if err = json.Unmarshal(last, &r); err != nil {
+		return nil, ErrRecordInvalid
+	}
+	return &r, nil
+}
+
+const maxLineSize = 16 * 1024 * 1024
+
+func globEscape(s string) string {
+	return strings.NewReplacer(`*`, `\*`, `?`, `\?`, `[`, `\[`).Replace(s)
+}
@@ -0,0 +1,180 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package client
+
+import (
+	"io"
+	"net/http"
+	"strings"
+)
+
+func NewBearerTransport(t http.RoundTripper, token string) *BearerTransport {
+	return &BearerTransport{
+		T:     defaultTransport(t),
+		Token: token,
+	}
+}
+
+// BearerTransport authenticates requests with a static bearer token
+type BearerTransport struct {
+	T     http.RoundTripper
+	Token string
+	// Host limits the token to requests for this host, when empty to the host of the first request of a redirect chain
+	Host string
+}
+
+func (m *BearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !authorizedHost(req, m.Host) {
+		return m.T.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+m.Token)
+	return m.T.RoundTrip(req)
+}
+
+func NewBasicAuthTransport(t http.RoundTripper, username string, password string) *BasicAuthTransport {
+	return &BasicAuthTransport{
+		T:        defaultTransport(t),
+		Username: username,
+		Password: password,
+	}
+}
+
+type BasicAuthTransport struct {
+	T        http.RoundTripper
+	Username string
+	Password string
+	// Host limits the credentials to requests for this host, when empty to the host of the first request of a redirect chain
+	Host string
+}
+
+func (m *BasicAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !authorizedHost(req, m.Host) {
+		return m.T.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	req.SetBasicAuth(m.Username, m.Password)
+	return m.T.RoundTrip(req)
+}
+
+// NewApiKeyTransport sends the API key in the header name, or in the query parameter name when inQuery is true
+func NewApiKeyTransport(t http.RoundTripper, name string, value string, inQuery bool) *ApiKeyTransport {
+	return &ApiKeyTransport{
+		T:       defaultTransport(t),
+		Name:    name,
+		Value:   value,
+		InQuery: inQuery,
+	}
+}
+
+type ApiKeyTransport struct {
+	T       http.RoundTripper
+	Name    string
+	Value   string
+	InQuery bool
+	// Host limits the key to requests for this host, when empty to the host of the first request of a redirect chain
+	Host string
+}
+
+func (m *ApiKeyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !authorizedHost(req, m.Host) {
+		return m.T.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	if m.InQuery {
+		query := req.URL.Query()
+		query.Set(m.Name, m.Value)
+		req.URL.RawQuery = query.Encode()
+	} else {
+		req.Header.Set(m.Name, m.Value)
+	}
+	return m.T.RoundTrip(req)
+}
+
+func NewTokenTransport(t http.RoundTripper, source TokenSource) *TokenTransport {
+	return &TokenTransport{
+		T:      defaultTransport(t),
+		Source: source,
+	}
+}
+
+// TokenTransport authenticates requests with tokens from Source.
+// When the server rejects a token with 401 Unauthorized, the token is invalidated and a replayable request is sent once more.
+type TokenTransport struct {
+	T      http.RoundTripper
+	Source TokenSource
+	// Host limits tokens to requests for this host, when empty to the host of the first request of a redirect chain
+	Host string
+}
+
+func (m *TokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !authorizedHost(req, m.Host) {
+		return m.T.RoundTrip(req)
+	}
+	res, token, err := m.roundTrip(req, req.Body)
+	if err != nil || res.StatusCode != http.StatusUnauthorized {
+		return res, err
+	}
+
+	invalidator, ok := m.Source.(interface{ Invalidate(token *Token) })
+	replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	if !ok || !replayable {
+		return res, nil
+	}
+	invalidator.Invalidate(token)
+
+	body := req.Body
+	if req.GetBody != nil {
+		if body, err = req.GetBody(); err != nil {
+			return res, nil
+		}
+	}
+	_ = res.Body.Close()
+	res, _, err = m.roundTrip(req, body)
+	return res, err
+}
+
+func (m *TokenTransport) roundTrip(req *http.Request, body io.ReadCloser) (*http.Response, *Token, error) {
+	token, err := m.Source.Token(req.Context())
+	if err != nil {
+		if body != nil {
+			_ = body.Close()
+		}
+		return nil, nil, err
+	}
+
+	req = req.Clone(req.Context())
+	req.Body = body
+	req.Header.Set("Authorization", token.Type()+" "+token.AccessToken)
+
+	var res *http.Response
+	res, err = m.T.RoundTrip(req)
+	return res, token, err
+}
+
+// authorizedHost reports whether credentials may be added to req, which is the case when it targets host.
+// Without host, credentials are limited to the host of the first request, so redirects to other hosts do not receive them.
+func authorizedHost(req *http.Request, host string) bool {
+	if host == "" {
+		original := req
+		for original.Response != nil && original.Response.Request != nil {
+			original = original.Response.Request
+		}
+		host = original.URL.Host
+	}
+	return strings.EqualFold(req.URL.Host, host)
+}
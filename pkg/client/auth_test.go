@@ -0,0 +1,143 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+type staticTokenSource string
+
+func (s staticTokenSource) Token(_ context.Context) (*Token, error) {
+	return &Token{AccessToken: string(s)}, nil
+}
+
+func TestAuthTransports_Redirect(t *testing.T) {
+	var received []string
+	record := func(r *http.Request) {
+		received = append(received, r.Host+" "+r.Header.Get("Authorization")+r.Header.Get("X-Api-Key")+r.URL.Query().Get("key"))
+	}
+
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		record(r)
+	}))
+	defer other.Close()
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		record(r)
+		switch r.URL.Path {
+		case "/same":
+			http.Redirect(w, r, "/target", http.StatusFound)
+		case "/other":
+			http.Redirect(w, r, other.URL+"/target", http.StatusFound)
+		}
+	}))
+	defer origin.Close()
+
+	originHost := hostOf(t, origin.URL)
+	otherHost := hostOf(t, other.URL)
+
+	tests := []struct {
+		name      string
+		transport func(t http.RoundTripper) http.RoundTripper
+		path      string
+		want      []string
+	}{
+		{
+			name:      "bearer same host redirect",
+			transport: func(t http.RoundTripper) http.RoundTripper { return NewBearerTransport(t, "secret") },
+			path:      "/same",
+			want:      []string{originHost + " Bearer secret", originHost + " Bearer secret"},
+		},
+		{
+			name:      "bearer cross host redirect",
+			transport: func(t http.RoundTripper) http.RoundTripper { return NewBearerTransport(t, "secret") },
+			path:      "/other",
+			want:      []string{originHost + " Bearer secret", otherHost + " "},
+		},
+		{
+			name:      "basic auth cross host redirect",
+			transport: func(t http.RoundTripper) http.RoundTripper { return NewBasicAuthTransport(t, "user", "pass") },
+			path:      "/other",
+			want:      []string{originHost + " Basic dXNlcjpwYXNz", otherHost + " "},
+		},
+		{
+			name: "api key header cross host redirect",
+			transport: func(t http.RoundTripper) http.RoundTripper {
+				return NewApiKeyTransport(t, "X-Api-Key", "secret", false)
+			},
+			path: "/other",
+			want: []string{originHost + " secret", otherHost + " "},
+		},
+		{
+			name:      "api key query cross host redirect",
+			transport: func(t http.RoundTripper) http.RoundTripper { return NewApiKeyTransport(t, "key", "secret", true) },
+			path:      "/other",
+			want:      []string{originHost + " secret", otherHost + " "},
+		},
+		{
+			name:      "token cross host redirect",
+			transport: func(t http.RoundTripper) http.RoundTripper { return NewTokenTransport(t, staticTokenSource("secret")) },
+			path:      "/other",
+			want:      []string{originHost + " Bearer secret", otherHost + " "},
+		},
+		{
+			name: "configured host",
+			transport: func(t http.RoundTripper) http.RoundTripper {
+				m := NewBearerTransport(t, "secret")
+				m.Host = otherHost
+				return m
+			},
+			path: "/other",
+			want: []string{originHost + " ", otherHost + " Bearer secret"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received = nil
+			c := &http.Client{Transport: tt.transport(http.DefaultTransport)}
+
+			res, err := c.Get(origin.URL + tt.path)
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			_ = res.Body.Close()
+
+			if len(received) != len(tt.want) {
+				t.Fatalf("received %q, want %q", received, tt.want)
+			}
+			for i := range tt.want {
+				if received[i] != tt.want[i] {
+					t.Errorf("request %d = %q, want %q", i, received[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func hostOf(t *testing.T, rawUrl string) string {
+	t.Helper()
+
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Host
+}
@@ -0,0 +1,281 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package client
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/corelayer/go-kit/pkg/pathutils"
+)
+
+// CacheEntry is a stored response with the request headers it varies on
+type CacheEntry struct {
+	StatusCode   int               `json:"statusCode"`
+	Header       http.Header       `json:"header"`
+	Body         []byte            `json:"body"`
+	Vary         map[string]string `json:"vary,omitempty"`
+	RequestTime  time.Time         `json:"requestTime"`
+	ResponseTime time.Time         `json:"responseTime"`
+}
+
+func (e *CacheEntry) size() int64 {
+	size := int64(len(e.Body))
+	for k, values := range e.Header {
+		for _, v := range values {
+			size += int64(len(k) + len(v))
+		}
+	}
+	return size
+}
+
+type CacheStore interface {
+	Get(key string) (*CacheEntry, bool)
+	Set(key string, e *CacheEntry)
+	Delete(key string)
+}
+
+// NewMemoryCacheStore creates a store keeping at most maxSize bytes of responses in memory, evicting the least recently used
+func NewMemoryCacheStore(maxSize int64) *MemoryCacheStore {
+	return &MemoryCacheStore{
+		maxSize: maxSize,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+type MemoryCacheStore struct {
+	maxSize int64
+	size    int64
+	entries map[string]*list.Element
+	lru     *list.List
+	mux     sync.Mutex
+}
+
+type memoryCacheItem struct {
+	key   string
+	entry *CacheEntry
+	size  int64
+}
+
+func (s *MemoryCacheStore) Get(key string) (*CacheEntry, bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	element, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	s.lru.MoveToFront(element)
+	return element.Value.(*memoryCacheItem).entry, true
+}
+
+func (s *MemoryCacheStore) Set(key string, e *CacheEntry) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.deleteLocked(key)
+	item := &memoryCacheItem{key: key, entry: e, size: e.size()}
+	if item.size > s.maxSize {
+		return
+	}
+	s.entries[key] = s.lru.PushFront(item)
+	s.size += item.size
+
+	for s.size > s.maxSize {
+		s.deleteLocked(s.lru.Back().Value.(*memoryCacheItem).key)
+	}
+}
+
+func (s *MemoryCacheStore) Delete(key string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.deleteLocked(key)
+}
+
+func (s *MemoryCacheStore) deleteLocked(key string) {
+	if element, ok := s.entries[key]; ok {
+		s.size -= element.Value.(*memoryCacheItem).size
+		s.lru.Remove(element)
+		delete(s.entries, key)
+	}
+}
+
+// DefaultCacheDirectory returns the http cache directory for application in the user cache directory
+func DefaultCacheDirectory(application string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, application, "http"), nil
+}
+
+// NewDiskCacheStore creates a store keeping at most maxSize bytes of responses as files in path, evicting the least recently used.
+// Entries written by earlier processes are reused, their access order is restored from the file modification times.
+func NewDiskCacheStore(path string, maxSize int64) (*DiskCacheStore, error) {
+	var (
+		err          error
+		expandedPath string
+		files        []string
+	)
+
+	if expandedPath, err = pathutils.GetExpandedPath(path); err != nil {
+		return nil, err
+	}
+	if err = pathutils.CreateDirectory(expandedPath, 0700); err != nil {
+		return nil, err
+	}
+	if files, err = pathutils.GetFilenames(expandedPath, []string{".cache"}); err != nil {
+		return nil, err
+	}
+
+	s := &DiskCacheStore{
+		path:    expandedPath,
+		maxSize: maxSize,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+
+	items := make([]*diskCacheItem, 0, len(files))
+	for _, file := range files {
+		var info os.FileInfo
+		if info, err = os.Stat(file); err != nil {
+			continue
+		}
+		items = append(items, &diskCacheItem{name: filepath.Base(file), size: info.Size(), accessed: info.ModTime()})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].accessed.Before(items[j].accessed)
+	})
+	for _, item := range items {
+		s.entries[item.name] = s.lru.PushFront(item)
+		s.size += item.size
+	}
+
+	s.mux.Lock()
+	s.evictLocked()
+	s.mux.Unlock()
+	return s, nil
+}
+
+type DiskCacheStore struct {
+	path    string
+	maxSize int64
+	size    int64
+	entries map[string]*list.Element
+	lru     *list.List
+	mux     sync.Mutex
+}
+
+type diskCacheItem struct {
+	name     string
+	size     int64
+	accessed time.Time
+}
+
+type diskCacheFile struct {
+	Key   string      `json:"key"`
+	Entry *CacheEntry `json:"entry"`
+}
+
+func (s *DiskCacheStore) Get(key string) (*CacheEntry, bool) {
+	name := s.filename(key)
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	element, ok := s.entries[name]
+	if !ok {
+		return nil, false
+	}
+
+	content, err := os.ReadFile(filepath.Join(s.path, name))
+	if err != nil {
+		s.deleteLocked(name)
+		return nil, false
+	}
+	var f diskCacheFile
+	if err = json.Unmarshal(content, &f); err != nil || f.Key != key || f.Entry == nil {
+		s.deleteLocked(name)
+		return nil, false
+	}
+
+	now := time.Now()
+	_ = os.Chtimes(filepath.Join(s.path, name), now, now)
+	s.lru.MoveToFront(element)
+	return f.Entry, true
+}
+
+func (s *DiskCacheStore) Set(key string, e *CacheEntry) {
+	name := s.filename(key)
+	content, err := json.Marshal(diskCacheFile{Key: key, Entry: e})
+	if err != nil || int64(len(content)) > s.maxSize {
+		return
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.deleteLocked(name)
+	file := filepath.Join(s.path, name)
+	tmp := file + ".tmp"
+	if err = os.WriteFile(tmp, content, 0600); err != nil {
+		return
+	}
+	if err = os.Rename(tmp, file); err != nil {
+		_ = os.Remove(tmp)
+		return
+	}
+
+	s.entries[name] = s.lru.PushFront(&diskCacheItem{name: name, size: int64(len(content)), accessed: time.Now()})
+	s.size += int64(len(content))
+	s.evictLocked()
+}
+
+func (s *DiskCacheStore) Delete(key string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.deleteLocked(s.filename(key))
+}
+
+func (s *DiskCacheStore) deleteLocked(name string) {
+	if element, ok := s.entries[name]; ok {
+		s.size -= element.Value.(*diskCacheItem).size
+		s.lru.Remove(element)
+		delete(s.entries, name)
+	}
+	_ = os.Remove(filepath.Join(s.path, name))
+}
+
+func (s *DiskCacheStore) evictLocked() {
+	for s.size > s.maxSize && s.lru.Len() > 0 {
+		s.deleteLocked(s.lru.Back().Value.(*diskCacheItem).name)
+	}
+}
+
+func (s *DiskCacheStore) filename(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:]) + ".cache"
+}
@@ -0,0 +1,353 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package client
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/corelayer/go-kit/pkg/internal/ioutils"
+)
+
+type CacheOptions struct {
+	Store CacheStore
+	// MaxEntrySize is the largest response body stored, larger responses are passed through
+	MaxEntrySize int64
+	// StaleIfError serves stale responses up to this age past their expiry when the origin fails with an error or a 5xx status.
+	// A stale-if-error directive in the response takes precedence.
+	StaleIfError time.Duration
+}
+
+func DefaultCacheOptions(store CacheStore) CacheOptions {
+	return CacheOptions{
+		Store:        store,
+		MaxEntrySize: 10 * 1024 * 1024,
+	}
+}
+
+func NewCacheTransport(t http.RoundTripper, o CacheOptions) *CacheTransport {
+	return &CacheTransport{
+		T:       defaultTransport(t),
+		Options: o,
+	}
+}
+
+// CacheTransport is a private HTTP cache following RFC 9111 for GET requests.
+// Fresh responses are served from the store, stale responses are revalidated with their ETag or Last-Modified validators.
+// Served responses carry an X-Cache header with HIT, REVALIDATED or STALE.
+type CacheTransport struct {
+	T       http.RoundTripper
+	Options CacheOptions
+}
+
+// Statuses which are cacheable without explicit freshness information, RFC 9110 section 15.1
+var heuristicallyCacheable = []int{200, 203, 204, 206, 300, 301, 308, 404, 405, 410, 414, 501}
+
+func (m *CacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := req.URL.String()
+
+	if req.Method != http.MethodGet {
+		res, err := m.T.RoundTrip(req)
+		// Unsafe methods invalidate the stored response, RFC 9111 section 4.4
+		if err == nil && req.Method != http.MethodHead && req.Method != http.MethodOptions && res.StatusCode < 400 {
+			m.Options.Store.Delete(key)
+		}
+		return res, err
+	}
+
+	requestDirectives := parseCacheControl(req.Header.Get("Cache-Control"))
+	if _, ok := requestDirectives["no-store"]; ok {
+		return m.T.RoundTrip(req)
+	}
+
+	entry, ok := m.Options.Store.Get(key)
+	if ok && !varyMatches(entry, req) {
+		entry, ok = nil, false
+	}
+
+	if !ok {
+		if _, onlyIfCached := requestDirectives["only-if-cached"]; onlyIfCached {
+			return cacheResponse(req, &CacheEntry{StatusCode: http.StatusGatewayTimeout, Header: http.Header{}}, "MISS"), nil
+		}
+		return m.fetch(req, key)
+	}
+
+	responseDirectives := parseCacheControl(entry.Header.Get("Cache-Control"))
+	age := entryAge(entry)
+	lifetime := freshnessLifetime(entry, responseDirectives)
+	if fresh(age, lifetime, requestDirectives, responseDirectives) {
+		return cacheResponse(req, entry, "HIT"), nil
+	}
+	if _, onlyIfCached := requestDirectives["only-if-cached"]; onlyIfCached {
+		return cacheResponse(req, &CacheEntry{StatusCode: http.StatusGatewayTimeout, Header: http.Header{}}, "MISS"), nil
+	}
+
+	// Revalidate the stored response
+	conditional := req.Clone(req.Context())
+	if etag := entry.Header.Get("ETag"); etag != "" {
+		conditional.Header.Set("If-None-Match", etag)
+	}
+	if lastModified := entry.Header.Get("Last-Modified"); lastModified != "" {
+		conditional.Header.Set("If-Modified-Since", lastModified)
+	}
+
+	requestTime := time.Now()
+	res, err := m.T.RoundTrip(conditional)
+	if err != nil || res.StatusCode >= http.StatusInternalServerError {
+		if m.staleIfError(age-lifetime, responseDirectives) {
+			if res != nil {
+				_ = res.Body.Close()
+			}
+			return cacheResponse(req, entry, "STALE"), nil
+		}
+		return res, err
+	}
+
+	if res.StatusCode == http.StatusNotModified {
+		_, _ = io.Copy(io.Discard, res.Body)
+		_ = res.Body.Close()
+
+		// Update the stored headers with those of the 304 response, RFC 9111 section 4.3.4
+		updated := *entry
+		updated.Header = entry.Header.Clone()
+		for k, v := range res.Header {
+			if k != "Content-Length" {
+				updated.Header[k] = v
+			}
+		}
+		updated.RequestTime = requestTime
+		updated.ResponseTime = time.Now()
+		m.Options.Store.Set(key, &updated)
+		return cacheResponse(req, &updated, "REVALIDATED"), nil
+	}
+
+	return m.store(req, key, res, requestTime)
+}
+
+func (m *CacheTransport) fetch(req *http.Request, key string) (*http.Response, error) {
+	requestTime := time.Now()
+	res, err := m.T.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	return m.store(req, key, res, requestTime)
+}
+
+// store saves res when it is cacheable, the caller receives the response body unchanged
+func (m *CacheTransport) store(req *http.Request, key string, res *http.Response, requestTime time.Time) (*http.Response, error) {
+	res.Header.Set("X-Cache", "MISS")
+	if !cacheable(req, res) {
+		return res, nil
+	}
+
+	body, peeked, err := ioutils.PeekBody(res.Body, m.Options.MaxEntrySize+1)
+	if err != nil || int64(len(body)) > m.Options.MaxEntrySize {
+		res.Body = peeked
+		return res, nil
+	}
+	_ = res.Body.Close()
+	res.Body = io.NopCloser(bytes.NewReader(body))
+
+	entry := &CacheEntry{
+		StatusCode:   res.StatusCode,
+		Header:       res.Header.Clone(),
+		Body:         body,
+		RequestTime:  requestTime,
+		ResponseTime: time.Now(),
+	}
+	entry.Header.Del("X-Cache")
+	for _, field := range headerValues(res.Header, "Vary") {
+		if entry.Vary == nil {
+			entry.Vary = make(map[string]string)
+		}
+		entry.Vary[http.CanonicalHeaderKey(field)] = req.Header.Get(field)
+	}
+	m.Options.Store.Set(key, entry)
+	return res, nil
+}
+
+func (m *CacheTransport) staleIfError(staleness time.Duration, directives map[string]string) bool {
+	limit := m.Options.StaleIfError
+	if v, ok := directives["stale-if-error"]; ok {
+		if seconds, err := strconv.Atoi(v); err == nil {
+			limit = time.Duration(seconds) * time.Second
+		}
+	}
+	if _, ok := directives["must-revalidate"]; ok {
+		return false
+	}
+	return staleness <= limit
+}
+
+func cacheable(req *http.Request, res *http.Response) bool {
+	if req.Header.Get("Range") != "" {
+		return false
+	}
+	directives := parseCacheControl(res.Header.Get("Cache-Control"))
+	if _, ok := directives["no-store"]; ok {
+		return false
+	}
+	if slices.Contains(headerValues(res.Header, "Vary"), "*") {
+		return false
+	}
+	if res.StatusCode == http.StatusPartialContent {
+		return false
+	}
+
+	_, maxAge := directives["max-age"]
+	_, public := directives["public"]
+	_, noCache := directives["no-cache"]
+	explicit := maxAge || public || noCache || res.Header.Get("Expires") != ""
+	validators := res.Header.Get("ETag") != "" || res.Header.Get("Last-Modified") != ""
+	return (explicit || validators) && (explicit || slices.Contains(heuristicallyCacheable, res.StatusCode))
+}
+
+func varyMatches(entry *CacheEntry, req *http.Request) bool {
+	for field, value := range entry.Vary {
+		if req.Header.Get(field) != value {
+			return false
+		}
+	}
+	return true
+}
+
+// entryAge returns the current age of the stored response, RFC 9111 section 4.2.3
+func entryAge(entry *CacheEntry) time.Duration {
+	var apparentAge time.Duration
+	if date, err := http.ParseTime(entry.Header.Get("Date")); err == nil {
+		apparentAge = max(0, entry.ResponseTime.Sub(date))
+	}
+
+	var ageValue time.Duration
+	if seconds, err := strconv.Atoi(entry.Header.Get("Age")); err == nil {
+		ageValue = time.Duration(seconds) * time.Second
+	}
+	correctedAge := ageValue + entry.ResponseTime.Sub(entry.RequestTime)
+
+	return max(apparentAge, correctedAge) + time.Since(entry.ResponseTime)
+}
+
+// freshnessLifetime returns the explicit or heuristic freshness lifetime, RFC 9111 section 4.2.1
+func freshnessLifetime(entry *CacheEntry, directives map[string]string) time.Duration {
+	if v, ok := directives["max-age"]; ok {
+		if seconds, err := strconv.Atoi(v); err == nil {
+			return time.Duration(seconds) * time.Second
+		}
+		return 0
+	}
+
+	date, dateErr := http.ParseTime(entry.Header.Get("Date"))
+	if dateErr != nil {
+		date = entry.ResponseTime
+	}
+	if expires := entry.Header.Get("Expires"); expires != "" {
+		t, err := http.ParseTime(expires)
+		if err != nil {
+			return 0
+		}
+		return max(0, t.Sub(date))
+	}
+
+	// Heuristic freshness of 10% of the time since the last modification, capped at a day
+	if lastModified, err := http.ParseTime(entry.Header.Get("Last-Modified")); err == nil && slices.Contains(heuristicallyCacheable, entry.StatusCode) {
+		return min(date.Sub(lastModified)/10, 24*time.Hour)
+	}
+	return 0
+}
+
+func fresh(age time.Duration, lifetime time.Duration, requestDirectives map[string]string, responseDirectives map[string]string) bool {
+	if _, ok := responseDirectives["no-cache"]; ok {
+		return false
+	}
+	if _, ok := requestDirectives["no-cache"]; ok {
+		return false
+	}
+	if v, ok := requestDirectives["max-age"]; ok {
+		if seconds, err := strconv.Atoi(v); err == nil && age > time.Duration(seconds)*time.Second {
+			return false
+		}
+	}
+	if v, ok := requestDirectives["min-fresh"]; ok {
+		if seconds, err := strconv.Atoi(v); err == nil {
+			age += time.Duration(seconds) * time.Second
+		}
+	}
+	if age < lifetime {
+		return true
+	}
+
+	if v, ok := requestDirectives["max-stale"]; ok {
+		if _, mustRevalidate := responseDirectives["must-revalidate"]; mustRevalidate {
+			return false
+		}
+		if v == "" {
+			return true
+		}
+		if seconds, err := strconv.Atoi(v); err == nil {
+			return age-lifetime <= time.Duration(seconds)*time.Second
+		}
+	}
+	return false
+}
+
+func cacheResponse(req *http.Request, entry *CacheEntry, state string) *http.Response {
+	header := entry.Header.Clone()
+	header.Set("X-Cache", state)
+	if state != "MISS" {
+		header.Set("Age", strconv.Itoa(int(entryAge(entry).Seconds())))
+	}
+
+	return &http.Response{
+		Status:        strconv.Itoa(entry.StatusCode) + " " + http.StatusText(entry.StatusCode),
+		StatusCode:    entry.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(entry.Body)),
+		ContentLength: int64(len(entry.Body)),
+		Request:       req,
+	}
+}
+
+func parseCacheControl(value string) map[string]string {
+	directives := make(map[string]string)
+	for _, d := range strings.Split(value, ",") {
+		name, v, _ := strings.Cut(strings.TrimSpace(d), "=")
+		if name != "" {
+			directives[strings.ToLower(name)] = strings.Trim(v, `"`)
+		}
+	}
+	return directives
+}
+
+func headerValues(h http.Header, name string) []string {
+	var output []string
+	for _, value := range h.Values(name) {
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				output = append(output, v)
+			}
+		}
+	}
+	return output
+}
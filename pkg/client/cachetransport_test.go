@@ -0,0 +1,247 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+package client
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestCacheTransport_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		// origin answers the nth request to the origin, starting at 1
+		origin func(w http.ResponseWriter, r *http.Request, n int)
+		second func(req *http.Request)
+		method string
+		calls  int
+		state  string
+		body   string
+	}{
+		{
+			name: "fresh response is served from the cache",
+			origin: func(w http.ResponseWriter, r *http.Request, n int) {
+				w.Header().Set("Cache-Control", "max-age=60")
+				_, _ = w.Write([]byte("response " + strconv.Itoa(n)))
+			},
+			calls: 1,
+			state: "HIT",
+			body:  "response 1",
+		},
+		{
+			name: "no-store response is not stored",
+			origin: func(w http.ResponseWriter, r *http.Request, n int) {
+				w.Header().Set("Cache-Control", "no-store, max-age=60")
+				_, _ = w.Write([]byte("response " + strconv.Itoa(n)))
+			},
+			calls: 2,
+			state: "MISS",
+			body:  "response 2",
+		},
+		{
+			name: "stale response is revalidated",
+			origin: func(w http.ResponseWriter, r *http.Request, n int) {
+				w.Header().Set("Cache-Control", "max-age=0")
+				w.Header().Set("ETag", `"v1"`)
+				if r.Header.Get("If-None-Match") == `"v1"` {
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				_, _ = w.Write([]byte("response " + strconv.Itoa(n)))
+			},
+			calls: 2,
+			state: "REVALIDATED",
+			body:  "response 1",
+		},
+		{
+			name: "changed response replaces the stored response",
+			origin: func(w http.ResponseWriter, r *http.Request, n int) {
+				w.Header().Set("Cache-Control", "max-age=0")
+				w.Header().Set("ETag", `"v`+strconv.Itoa(n)+`"`)
+				_, _ = w.Write([]byte("response " + strconv.Itoa(n)))
+			},
+			calls: 2,
+			state: "MISS",
+			body:  "response 2",
+		},
+		{
+			name: "stale response is served when the origin fails",
+			origin: func(w http.ResponseWriter, r *http.Request, n int) {
+				if n > 1 {
+					w.WriteHeader(http.StatusBadGateway)
+					return
+				}
+				w.Header().Set("Cache-Control", "max-age=0, stale-if-error=60")
+				w.Header().Set("ETag", `"v1"`)
+				_, _ = w.Write([]byte("response " + strconv.Itoa(n)))
+			},
+			calls: 2,
+			state: "STALE",
+			body:  "response 1",
+		},
+		{
+			name: "must-revalidate response is not served when the origin fails",
+			origin: func(w http.ResponseWriter, r *http.Request, n int) {
+				if n > 1 {
+					w.WriteHeader(http.StatusBadGateway)
+					return
+				}
+				w.Header().Set("Cache-Control", "max-age=0, stale-if-error=60, must-revalidate")
+				w.Header().Set("ETag", `"v1"`)
+				_, _ = w.Write([]byte("response " + strconv.Itoa(n)))
+			},
+			calls: 2,
+			state: "",
+			body:  "",
+		},
+		{
+			name: "request with different vary header is not served from the cache",
+			origin: func(w http.ResponseWriter, r *http.Request, n int) {
+				w.Header().Set("Cache-Control", "max-age=60")
+				w.Header().Set("Vary", "Accept-Language")
+				_, _ = w.Write([]byte("response " + strconv.Itoa(n)))
+			},
+			second: func(req *http.Request) {
+				req.Header.Set("Accept-Language", "nl")
+			},
+			calls: 2,
+			state: "MISS",
+			body:  "response 2",
+		},
+		{
+			name: "request no-cache revalidates a fresh response",
+			origin: func(w http.ResponseWriter, r *http.Request, n int) {
+				w.Header().Set("Cache-Control", "max-age=60")
+				w.Header().Set("ETag", `"v1"`)
+				if r.Header.Get("If-None-Match") == `"v1"` {
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				_, _ = w.Write([]byte("response " + strconv.Itoa(n)))
+			},
+			second: func(req *http.Request) {
+				req.Header.Set("Cache-Control", "no-cache")
+			},
+			calls: 2,
+			state: "REVALIDATED",
+			body:  "response 1",
+		},
+		{
+			name: "unsafe request invalidates the stored response",
+			origin: func(w http.ResponseWriter, r *http.Request, n int) {
+				w.Header().Set("Cache-Control", "max-age=60")
+				_, _ = w.Write([]byte("response " + strconv.Itoa(n)))
+			},
+			method: http.MethodPost,
+			calls:  3,
+			state:  "MISS",
+			body:   "response 3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				tt.origin(w, r, calls)
+			}))
+			defer server.Close()
+
+			c := &http.Client{Transport: NewCacheTransport(nil, DefaultCacheOptions(NewMemoryCacheStore(1<<20)))}
+			if _, _, err := cacheGet(c, server.URL, nil); err != nil {
+				t.Fatalf("first request error = %v", err)
+			}
+			if tt.method != "" {
+				req, _ := http.NewRequest(tt.method, server.URL, nil)
+				res, err := c.Do(req)
+				if err != nil {
+					t.Fatalf("%s request error = %v", tt.method, err)
+				}
+				_ = res.Body.Close()
+			}
+
+			state, body, err := cacheGet(c, server.URL, tt.second)
+			if err != nil {
+				t.Fatalf("second request error = %v", err)
+			}
+			if calls != tt.calls {
+				t.Errorf("origin calls = %d, want %d", calls, tt.calls)
+			}
+			if state != tt.state {
+				t.Errorf("X-Cache = %q, want %q", state, tt.state)
+			}
+			if body != tt.body {
+				t.Errorf("body = %q, want %q", body, tt.body)
+			}
+		})
+	}
+}
+
+func TestDiskCacheStore(t *testing.T) {
+	path := t.TempDir()
+	store, err := NewDiskCacheStore(path, 1<<20)
+	if err != nil {
+		t.Fatalf("NewDiskCacheStore() error = %v", err)
+	}
+	store.Set("https://example.com/", &CacheEntry{StatusCode: http.StatusOK, Header: http.Header{"Etag": {`"v1"`}}, Body: []byte("hello")})
+
+	// Entries survive reopening the store
+	if store, err = NewDiskCacheStore(path, 1<<20); err != nil {
+		t.Fatalf("NewDiskCacheStore() error = %v", err)
+	}
+	entry, found := store.Get("https://example.com/")
+	if !found {
+		t.Fatal("Get() did not find the stored entry")
+	}
+	if string(entry.Body) != "hello" || entry.Header.Get("ETag") != `"v1"` {
+		t.Errorf("Get() = %+v", entry)
+	}
+
+	store.Delete("https://example.com/")
+	if _, found = store.Get("https://example.com/"); found {
+		t.Error("Get() found a deleted entry")
+	}
+}
+
+// cacheGet returns the X-Cache header and body of a GET request, a 5xx status results in an empty body and state
+func cacheGet(c *http.Client, url string, modify func(req *http.Request)) (string, string, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return "", "", err
+	}
+	if modify != nil {
+		modify(req)
+	}
+
+	var res *http.Response
+	if res, err = c.Do(req); err != nil {
+		return "", "", err
+	}
+	defer res.Body.Close()
+
+	var body []byte
+	if body, err = io.ReadAll(res.Body); err != nil {
+		return "", "", err
+	}
+	if res.StatusCode >= http.StatusInternalServerError {
+		return "", "", nil
+	}
+	return res.Header.Get("X-Cache"), string(body), nil
+}
@@ -0,0 +1,274 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type CircuitState int
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+type CircuitBreakerOptions struct {
+	// FailureRatio opens the circuit when the ratio of failed requests within Window reaches it, once at least MinRequests were made
+	FailureRatio float64
+	MinRequests  int
+	Window       time.Duration
+	// OpenTimeout is the time the circuit stays open before HalfOpenRequests probe requests are let through
+	OpenTimeout      time.Duration
+	HalfOpenRequests int
+	// IsFailure classifies the outcome of a request, by default transport errors and 5xx responses are failures
+	IsFailure func(res *http.Response, err error) bool
+}
+
+func DefaultCircuitBreakerOptions() CircuitBreakerOptions {
+	return CircuitBreakerOptions{
+		FailureRatio:     0.5,
+		MinRequests:      10,
+		Window:           30 * time.Second,
+		OpenTimeout:      15 * time.Second,
+		HalfOpenRequests: 1,
+	}
+}
+
+// NewCircuitBreakerTransport creates a transport guarding the hosts reached through t, zero values in o are replaced by their defaults
+func NewCircuitBreakerTransport(t http.RoundTripper, o CircuitBreakerOptions) *CircuitBreakerTransport {
+	if t == nil {
+		t = http.DefaultTransport
+	}
+	if o.IsFailure == nil {
+		o.IsFailure = isCircuitFailure
+	}
+
+	defaults := DefaultCircuitBreakerOptions()
+	if o.FailureRatio <= 0 {
+		o.FailureRatio = defaults.FailureRatio
+	}
+	if o.MinRequests <= 0 {
+		o.MinRequests = defaults.MinRequests
+	}
+	if o.Window <= 0 {
+		o.Window = defaults.Window
+	}
+	if o.OpenTimeout <= 0 {
+		o.OpenTimeout = defaults.OpenTimeout
+	}
+	if o.HalfOpenRequests <= 0 {
+		o.HalfOpenRequests = defaults.HalfOpenRequests
+	}
+	return &CircuitBreakerTransport{
+		T:        t,
+		Options:  o,
+		breakers: make(map[string]*circuitBreaker),
+	}
+}
+
+// CircuitBreakerTransport keeps a circuit breaker per host, requests to a host with an open circuit fail immediately with an error wrapping ErrCircuitOpen.
+// Breakers of hosts which received no requests for longer than Window and OpenTimeout combined are discarded.
+type CircuitBreakerTransport struct {
+	T         http.RoundTripper
+	Options   CircuitBreakerOptions
+	breakers  map[string]*circuitBreaker
+	lastSweep time.Time
+	mux       sync.Mutex
+}
+
+func (m *CircuitBreakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	b := m.breaker(host)
+
+	if !b.allow(host, m.Options) {
+		return nil, fmt.Errorf("%s: %w", host, ErrCircuitOpen)
+	}
+
+	res, err := m.T.RoundTrip(req)
+	// Requests cancelled by the caller say nothing about the health of the host
+	if err != nil && errors.Is(err, context.Canceled) {
+		b.release()
+		return res, err
+	}
+	b.record(host, m.Options, m.Options.IsFailure(res, err))
+	return res, err
+}
+
+// State returns the state of the circuit for host
+func (m *CircuitBreakerTransport) State(host string) CircuitState {
+	m.mux.Lock()
+	b, ok := m.breakers[host]
+	m.mux.Unlock()
+	if !ok {
+		return CircuitClosed
+	}
+
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return b.state
+}
+
+func (m *CircuitBreakerTransport) breaker(host string) *circuitBreaker {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	now := time.Now()
+	idleTimeout := m.Options.Window + m.Options.OpenTimeout
+	if now.Sub(m.lastSweep) > idleTimeout {
+		for h, b := range m.breakers {
+			if b.idle(now, idleTimeout) {
+				delete(m.breakers, h)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	b, ok := m.breakers[host]
+	if !ok {
+		b = &circuitBreaker{windowStart: now, lastUsed: now}
+		m.breakers[host] = b
+	}
+	return b
+}
+
+func isCircuitFailure(res *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return res.StatusCode >= http.StatusInternalServerError
+}
+
+type circuitBreaker struct {
+	state       CircuitState
+	windowStart time.Time
+	openedAt    time.Time
+	requests    int
+	failures    int
+	probes      int
+	successes   int
+	lastUsed    time.Time
+	mux         sync.Mutex
+}
+
+func (b *circuitBreaker) allow(host string, o CircuitBreakerOptions) bool {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	now := time.Now()
+	b.lastUsed = now
+	switch b.state {
+	case CircuitOpen:
+		if now.Sub(b.openedAt) < o.OpenTimeout {
+			return false
+		}
+		b.transition(host, CircuitHalfOpen)
+		fallthrough
+	case CircuitHalfOpen:
+		if b.probes >= o.HalfOpenRequests {
+			return false
+		}
+		b.probes++
+	default:
+		if now.Sub(b.windowStart) > o.Window {
+			b.windowStart = now
+			b.requests = 0
+			b.failures = 0
+		}
+	}
+	return true
+}
+
+// idle reports whether the breaker has not been used for longer than timeout
+func (b *circuitBreaker) idle(now time.Time, timeout time.Duration) bool {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return now.Sub(b.lastUsed) > timeout
+}
+
+func (b *circuitBreaker) release() {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	if b.state == CircuitHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+func (b *circuitBreaker) record(host string, o CircuitBreakerOptions, failed bool) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	switch b.state {
+	case CircuitHalfOpen:
+		if failed {
+			b.transition(host, CircuitOpen)
+			return
+		}
+		if b.successes++; b.successes >= o.HalfOpenRequests {
+			b.transition(host, CircuitClosed)
+		}
+	case CircuitClosed:
+		b.requests++
+		if failed {
+			b.failures++
+		}
+		if b.requests >= o.MinRequests && float64(b.failures)/float64(b.requests) >= o.FailureRatio {
+			b.transition(host, CircuitOpen)
+		}
+	}
+}
+
+func (b *circuitBreaker) transition(host string, state CircuitState) {
+	level := slog.LevelInfo
+	if state == CircuitOpen {
+		level = slog.LevelWarn
+	}
+	slog.Log(context.Background(), level, "circuit breaker state changed", "host", host, "from", b.state.String(), "to", state.String(), "requests", b.requests, "failures", b.failures)
+
+	b.state = state
+	b.probes = 0
+	b.successes = 0
+	switch state {
+	case CircuitOpen:
+		b.openedAt = time.Now()
+	case CircuitClosed:
+		b.windowStart = time.Now()
+		b.requests = 0
+		b.failures = 0
+	}
+}
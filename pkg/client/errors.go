@@ -0,0 +1,163 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package client
+
+const (
+	ErrCacheStoreRequiredMessage       = "cache store is required"
+	ErrCertificatePinMismatchMessage   = "certificate does not match any pinned public key"
+	ErrCircuitOpenMessage              = "circuit breaker is open"
+	ErrInvalidBaseUrlMessage           = "base url is not an absolute http or https url"
+	ErrNoCertificatesMessage           = "no certificates found in PEM data"
+	ErrPageHostMismatchMessage         = "next page is on another host or scheme"
+	ErrPageTooLargeMessage             = "page exceeds the maximum size"
+	ErrProxyHandshakeMessage           = "proxy handshake failed"
+	ErrProxySchemeUnsupportedMessage   = "unsupported proxy scheme"
+	ErrSpkiPinInvalidMessage           = "invalid spki pin"
+	ErrSseUnexpectedContentTypeMessage = "unexpected content type for event stream"
+	ErrSseUnexpectedStatusMessage      = "unexpected status code for event stream"
+	ErrTokenRequestMessage             = "oauth2 token request failed"
+	ErrTooManyRedirectsMessage         = "too many redirects"
+)
+
+var (
+	ErrCacheStoreRequired       = CacheStoreRequiredError{message: ErrCacheStoreRequiredMessage}
+	ErrCertificatePinMismatch   = CertificatePinMismatchError{message: ErrCertificatePinMismatchMessage}
+	ErrCircuitOpen              = CircuitOpenError{message: ErrCircuitOpenMessage}
+	ErrInvalidBaseUrl           = InvalidBaseUrlError{message: ErrInvalidBaseUrlMessage}
+	ErrNoCertificates           = NoCertificatesError{message: ErrNoCertificatesMessage}
+	ErrPageHostMismatch         = PageHostMismatchError{message: ErrPageHostMismatchMessage}
+	ErrPageTooLarge             = PageTooLargeError{message: ErrPageTooLargeMessage}
+	ErrProxyHandshake           = ProxyHandshakeError{message: ErrProxyHandshakeMessage}
+	ErrProxySchemeUnsupported   = ProxySchemeUnsupportedError{message: ErrProxySchemeUnsupportedMessage}
+	ErrSpkiPinInvalid           = SpkiPinInvalidError{message: ErrSpkiPinInvalidMessage}
+	ErrSseUnexpectedContentType = SseUnexpectedContentTypeError{message: ErrSseUnexpectedContentTypeMessage}
+	ErrSseUnexpectedStatus      = SseUnexpectedStatusError{message: ErrSseUnexpectedStatusMessage}
+	ErrTokenRequest             = TokenRequestError{message: ErrTokenRequestMessage}
+	ErrTooManyRedirects         = TooManyRedirectsError{message: ErrTooManyRedirectsMessage}
+)
+
+type CacheStoreRequiredError struct {
+	message string
+}
+
+func (e CacheStoreRequiredError) Error() string {
+	return e.message
+}
+
+type CertificatePinMismatchError struct {
+	message string
+}
+
+func (e CertificatePinMismatchError) Error() string {
+	return e.message
+}
+
+type CircuitOpenError struct {
+	message string
+}
+
+func (e CircuitOpenError) Error() string {
+	return e.message
+}
+
+type InvalidBaseUrlError struct {
+	message string
+}
+
+func (e InvalidBaseUrlError) Error() string {
+	return e.message
+}
+
+type NoCertificatesError struct {
+	message string
+}
+
+func (e NoCertificatesError) Error() string {
+	return e.message
+}
+
+type PageHostMismatchError struct {
+	message string
+}
+
+func (e PageHostMismatchError) Error() string {
+	return e.message
+}
+
+type PageTooLargeError struct {
+	message string
+}
+
+func (e PageTooLargeError) Error() string {
+	return e.message
+}
+
+type ProxyHandshakeError struct {
+	message string
+}
+
+func (e ProxyHandshakeError) Error() string {
+	return e.message
+}
+
+type ProxySchemeUnsupportedError struct {
+	message string
+}
+
+func (e ProxySchemeUnsupportedError) Error() string {
+	return e.message
+}
+
+type SpkiPinInvalidError struct {
+	message string
+}
+
+func (e SpkiPinInvalidError) Error() string {
+	return e.message
+}
+
+type SseUnexpectedContentTypeError struct {
+	message string
+}
+
+func (e SseUnexpectedContentTypeError) Error() string {
+	return e.message
+}
+
+type SseUnexpectedStatusError struct {
+	message string
+}
+
+func (e SseUnexpectedStatusError) Error() string {
+	return e.message
+}
+
+type TokenRequestError struct {
+	message string
+}
+
+func (e TokenRequestError) Error() string {
+	return e.message
+}
+
+type TooManyRedirectsError struct {
+	message string
+}
+
+func (e TooManyRedirectsError) Error() string {
+	return e.message
+}
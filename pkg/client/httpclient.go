@@ -21,6 +21,7 @@ import (
 	"time"
 )
 
+// NewHttpClient creates a client with a timeout in seconds, use NewHttpClientWithOptions to configure the transport
 func NewHttpClient(useragent string, timeout int, followRedirects bool) *http.Client {
 	return &http.Client{
 		Transport:     NewHttpTransport(useragent),
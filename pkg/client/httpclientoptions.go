@@ -0,0 +1,275 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package client
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"time"
+)
+
+// HttpClientOption configures the client created by NewHttpClientWithOptions
+type HttpClientOption func(c *httpClientConfig) error
+
+type httpClientConfig struct {
+	timeout   time.Duration
+	dialer    *net.Dialer
+	transport *http.Transport
+	redirect  func(req *http.Request, via []*http.Request) error
+	auth      func(t http.RoundTripper) http.RoundTripper
+	jar       http.CookieJar
+	retry     *RetryOptions
+	breaker   *CircuitBreakerOptions
+	logging   *LoggingOptions
+	cache     *CacheOptions
+}
+
+// NewHttpClientWithOptions creates a client with sensible transport defaults, adjusted by opts.
+// Requests pass through the user agent, authentication, cache, retry, circuit breaker and logging layers before reaching the transport.
+func NewHttpClientWithOptions(useragent string, opts ...HttpClientOption) (*http.Client, error) {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	c := &httpClientConfig{
+		dialer:    dialer,
+		transport: newBaseTransport(dialer),
+		redirect:  DefaultRedirectPolicy().checkRedirect,
+	}
+
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+
+	var t http.RoundTripper = c.transport
+	if c.logging != nil {
+		t = NewLoggingTransport(t, *c.logging)
+	}
+	if c.breaker != nil {
+		t = NewCircuitBreakerTransport(t, *c.breaker)
+	}
+	if c.retry != nil {
+		t = NewRetryTransport(t, *c.retry)
+	}
+	if c.cache != nil {
+		t = NewCacheTransport(t, *c.cache)
+	}
+	if c.auth != nil {
+		t = c.auth(t)
+	}
+
+	return &http.Client{
+		Transport: &HttpTransport{
+			T:         t,
+			UserAgent: useragent,
+		},
+		CheckRedirect: c.redirect,
+		Jar:           c.jar,
+		Timeout:       c.timeout,
+	}, nil
+}
+
+func newBaseTransport(dialer *net.Dialer) *http.Transport {
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       &tls.Config{},
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+// WithTimeout limits the total time of a request, including redirects and reading the response body
+func WithTimeout(d time.Duration) HttpClientOption {
+	return func(c *httpClientConfig) error {
+		c.timeout = d
+		return nil
+	}
+}
+
+func WithDialTimeout(d time.Duration) HttpClientOption {
+	return func(c *httpClientConfig) error {
+		c.dialer.Timeout = d
+		return nil
+	}
+}
+
+func WithTlsHandshakeTimeout(d time.Duration) HttpClientOption {
+	return func(c *httpClientConfig) error {
+		c.transport.TLSHandshakeTimeout = d
+		return nil
+	}
+}
+
+func WithResponseHeaderTimeout(d time.Duration) HttpClientOption {
+	return func(c *httpClientConfig) error {
+		c.transport.ResponseHeaderTimeout = d
+		return nil
+	}
+}
+
+// WithKeepAlive sets the TCP keep-alive interval, a negative interval disables TCP keep-alives
+func WithKeepAlive(interval time.Duration) HttpClientOption {
+	return func(c *httpClientConfig) error {
+		c.dialer.KeepAlive = interval
+		return nil
+	}
+}
+
+// WithoutKeepAlives uses every connection for a single request
+func WithoutKeepAlives() HttpClientOption {
+	return func(c *httpClientConfig) error {
+		c.transport.DisableKeepAlives = true
+		return nil
+	}
+}
+
+// WithConnectionPool sets the idle connections kept in total and per host, the maximum connections per host and the idle timeout.
+// Zero values for maxConnsPerHost and idleTimeout mean no limit.
+func WithConnectionPool(maxIdle int, maxIdlePerHost int, maxConnsPerHost int, idleTimeout time.Duration) HttpClientOption {
+	return func(c *httpClientConfig) error {
+		c.transport.MaxIdleConns = maxIdle
+		c.transport.MaxIdleConnsPerHost = maxIdlePerHost
+		c.transport.MaxConnsPerHost = maxConnsPerHost
+		c.transport.IdleConnTimeout = idleTimeout
+		return nil
+	}
+}
+
+func WithHttp2(enabled bool) HttpClientOption {
+	return func(c *httpClientConfig) error {
+		c.transport.ForceAttemptHTTP2 = enabled
+		if !enabled {
+			// A non-nil empty map disables the automatic HTTP/2 upgrade
+			c.transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+		} else {
+			c.transport.TLSNextProto = nil
+		}
+		return nil
+	}
+}
+
+func WithRedirectPolicy(p RedirectPolicy) HttpClientOption {
+	return func(c *httpClientConfig) error {
+		c.redirect = p.checkRedirect
+		return nil
+	}
+}
+
+// WithoutRedirects returns redirect responses to the caller instead of following them
+func WithoutRedirects() HttpClientOption {
+	return func(c *httpClientConfig) error {
+		c.redirect = doNotFollowHttpRedirects
+		return nil
+	}
+}
+
+func WithCookieJar(jar http.CookieJar) HttpClientOption {
+	return func(c *httpClientConfig) error {
+		c.jar = jar
+		return nil
+	}
+}
+
+// WithCookies stores cookies received from servers in an in-memory jar
+func WithCookies() HttpClientOption {
+	return func(c *httpClientConfig) error {
+		jar, err := cookiejar.New(nil)
+		if err != nil {
+			return err
+		}
+		c.jar = jar
+		return nil
+	}
+}
+
+func WithRetry(o RetryOptions) HttpClientOption {
+	return func(c *httpClientConfig) error {
+		c.retry = &o
+		return nil
+	}
+}
+
+func WithCircuitBreaker(o CircuitBreakerOptions) HttpClientOption {
+	return func(c *httpClientConfig) error {
+		c.breaker = &o
+		return nil
+	}
+}
+
+// WithLogging logs every attempt, including retries
+func WithLogging(o LoggingOptions) HttpClientOption {
+	return func(c *httpClientConfig) error {
+		c.logging = &o
+		return nil
+	}
+}
+
+// WithCache serves responses from the cache described by o, e.g. DefaultCacheOptions(NewMemoryCacheStore(size))
+func WithCache(o CacheOptions) HttpClientOption {
+	return func(c *httpClientConfig) error {
+		if o.Store == nil {
+			return ErrCacheStoreRequired
+		}
+		c.cache = &o
+		return nil
+	}
+}
+
+func WithBearerToken(token string) HttpClientOption {
+	return func(c *httpClientConfig) error {
+		c.auth = func(t http.RoundTripper) http.RoundTripper {
+			return NewBearerTransport(t, token)
+		}
+		return nil
+	}
+}
+
+func WithBasicAuth(username string, password string) HttpClientOption {
+	return func(c *httpClientConfig) error {
+		c.auth = func(t http.RoundTripper) http.RoundTripper {
+			return NewBasicAuthTransport(t, username, password)
+		}
+		return nil
+	}
+}
+
+func WithApiKey(name string, value string, inQuery bool) HttpClientOption {
+	return func(c *httpClientConfig) error {
+		c.auth = func(t http.RoundTripper) http.RoundTripper {
+			return NewApiKeyTransport(t, name, value, inQuery)
+		}
+		return nil
+	}
+}
+
+// WithTokenSource authenticates requests with tokens from source, e.g. NewClientCredentialsTokenSource
+func WithTokenSource(source TokenSource) HttpClientOption {
+	return func(c *httpClientConfig) error {
+		c.auth = func(t http.RoundTripper) http.RoundTripper {
+			return NewTokenTransport(t, source)
+		}
+		return nil
+	}
+}
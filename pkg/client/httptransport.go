@@ -34,8 +34,16 @@ func (m *HttpTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 func NewHttpTransport(useragent string) *HttpTransport {
 	return &HttpTransport{
 		T: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
 			TLSClientConfig: &tls.Config{},
 		},
 		UserAgent: useragent,
 	}
 }
+
+func defaultTransport(t http.RoundTripper) http.RoundTripper {
+	if t == nil {
+		return http.DefaultTransport
+	}
+	return t
+}
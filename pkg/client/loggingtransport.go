@@ -0,0 +1,279 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/corelayer/go-kit/pkg/internal/ioutils"
+	"github.com/corelayer/go-kit/pkg/redact"
+)
+
+type LoggingOptions struct {
+	Logger *slog.Logger
+	// Level is used for the summary of every request, headers, bodies and curl commands are logged at debug level
+	Level       slog.Level
+	DumpHeaders bool
+	// DumpBodies logs JSON and form bodies with redacted fields, other bodies are omitted unless listed in DumpMediaTypes
+	DumpBodies bool
+	// DumpMediaTypes are additional media types whose bodies are logged as is, e.g. "text/plain"
+	DumpMediaTypes []string
+	// MaxBodySize limits the part of a body which is read for logging, the remainder is streamed
+	MaxBodySize int64
+	// Curl logs an equivalent curl command for every request, it only includes the body when it is logged through DumpBodies
+	Curl bool
+	// RedactHeaders are header names whose values are never logged
+	RedactHeaders []string
+	// RedactFields are JSON object keys, form fields and query parameters, matched case-insensitively, whose values are never logged
+	RedactFields []string
+}
+
+func DefaultLoggingOptions() LoggingOptions {
+	return LoggingOptions{
+		Level:         slog.LevelInfo,
+		MaxBodySize:   4096,
+		RedactHeaders: []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"},
+		RedactFields:  []string{"password", "secret", "client_secret", "token", "access_token", "refresh_token", "api_key"},
+	}
+}
+
+// NewLoggingTransport creates a transport logging the requests sent through t.
+// A zero MaxBodySize and nil redaction lists are replaced by their defaults, use empty lists to disable redaction.
+func NewLoggingTransport(t http.RoundTripper, o LoggingOptions) *LoggingTransport {
+	if o.Logger == nil {
+		o.Logger = slog.Default()
+	}
+
+	defaults := DefaultLoggingOptions()
+	if o.MaxBodySize <= 0 {
+		o.MaxBodySize = defaults.MaxBodySize
+	}
+	if o.RedactHeaders == nil {
+		o.RedactHeaders = defaults.RedactHeaders
+	}
+	if o.RedactFields == nil {
+		o.RedactFields = defaults.RedactFields
+	}
+
+	m := &LoggingTransport{
+		T:             defaultTransport(t),
+		Options:       o,
+		redactHeaders: make(map[string]struct{}, len(o.RedactHeaders)),
+		redactFields:  redact.NewFields(o.RedactFields...),
+	}
+	for _, h := range o.RedactHeaders {
+		m.redactHeaders[http.CanonicalHeaderKey(h)] = struct{}{}
+	}
+	return m
+}
+
+// LoggingTransport logs every request with its status, latency and sizes through slog
+type LoggingTransport struct {
+	T             http.RoundTripper
+	Options       LoggingOptions
+	redactHeaders map[string]struct{}
+	redactFields  redact.Fields
+}
+
+func (m *LoggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	debug := m.Options.Logger.Enabled(ctx, slog.LevelDebug)
+
+	var requestBody []byte
+	if debug && m.Options.DumpBodies && req.Body != nil && req.Body != http.NoBody {
+		// Only a prefix of the body is read, the remainder is streamed to the server
+		content, body, err := ioutils.PeekBody(req.Body, m.Options.MaxBodySize+1)
+		if err != nil {
+			_ = req.Body.Close()
+			return nil, err
+		}
+		requestBody = content
+		req = req.Clone(ctx)
+		req.Body = body
+	}
+
+	if debug && m.Options.Curl {
+		m.Options.Logger.DebugContext(ctx, "http request", "curl", m.curl(req, requestBody))
+	}
+	if debug && (m.Options.DumpHeaders || m.Options.DumpBodies) {
+		attrs := []any{"method", req.Method, "url", m.url(req.URL)}
+		if m.Options.DumpHeaders {
+			attrs = append(attrs, "headers", m.headers(req.Header))
+		}
+		if m.Options.DumpBodies && requestBody != nil {
+			body, _ := m.body(req.Header, requestBody)
+			attrs = append(attrs, "body", body)
+		}
+		m.Options.Logger.DebugContext(ctx, "http request dump", attrs...)
+	}
+
+	start := time.Now()
+	res, err := m.T.RoundTrip(req)
+	latency := time.Since(start)
+
+	if err != nil {
+		m.Options.Logger.Log(ctx, max(m.Options.Level, slog.LevelWarn), "http request failed", "method", req.Method, "url", m.url(req.URL), "latency", latency, "error", err)
+		return res, err
+	}
+
+	m.Options.Logger.Log(ctx, m.Options.Level, "http request", "method", req.Method, "url", m.url(req.URL), "status", res.StatusCode, "latency", latency, "requestSize", req.ContentLength, "responseSize", res.ContentLength)
+
+	if debug && (m.Options.DumpHeaders || m.Options.DumpBodies) {
+		attrs := []any{"method", req.Method, "url", m.url(req.URL), "status", res.StatusCode}
+		if m.Options.DumpHeaders {
+			attrs = append(attrs, "headers", m.headers(res.Header))
+		}
+		if m.Options.DumpBodies && dumpableResponse(res) {
+			// Only a prefix of the body is read, the caller receives the full body
+			prefix, body, readErr := ioutils.PeekBody(res.Body, m.Options.MaxBodySize+1)
+			res.Body = body
+			if readErr == nil {
+				dumped, _ := m.body(res.Header, prefix)
+				attrs = append(attrs, "body", dumped)
+			}
+		}
+		m.Options.Logger.DebugContext(ctx, "http response dump", attrs...)
+	}
+	return res, nil
+}
+
+// url returns u without password and with redacted query parameters
+func (m *LoggingTransport) url(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.Redacted()
+	}
+
+	copied := *u
+	copied.RawQuery = redact.Values(u.Query(), m.redactFields).Encode()
+	return copied.Redacted()
+}
+
+func (m *LoggingTransport) headers(h http.Header) map[string]string {
+	output := make(map[string]string, len(h))
+	for k, v := range h {
+		if _, ok := m.redactHeaders[http.CanonicalHeaderKey(k)]; ok {
+			output[k] = redact.Placeholder
+			continue
+		}
+		output[k] = strings.Join(v, ", ")
+	}
+	return output
+}
+
+// body returns the loggable representation of content, which is truncated when it exceeds MaxBodySize.
+// JSON and form bodies are redacted, other bodies are only returned when their media type is allowed.
+// The boolean is false when the representation is a placeholder for an omitted body.
+func (m *LoggingTransport) body(h http.Header, content []byte) (string, bool) {
+	truncated := int64(len(content)) > m.Options.MaxBodySize
+	if truncated {
+		content = content[:m.Options.MaxBodySize]
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	switch {
+	case isJsonContent(h):
+		// Truncated or invalid documents cannot be redacted reliably
+		var v any
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.UseNumber()
+		if truncated || decoder.Decode(&v) != nil {
+			return "[invalid or truncated json body omitted]", false
+		}
+
+		output, err := json.Marshal(redact.Json(v, m.redactFields))
+		if err != nil {
+			return "[json body omitted]", false
+		}
+		return string(output), true
+	case mediaType == "application/x-www-form-urlencoded":
+		values, err := url.ParseQuery(string(content))
+		if truncated || err != nil {
+			return "[invalid or truncated form body omitted]", false
+		}
+		return redact.Values(values, m.redactFields).Encode(), true
+	case slices.Contains(m.Options.DumpMediaTypes, mediaType):
+		// Truncated bodies are logged, but cannot be replayed with curl
+		return string(content), !truncated
+	default:
+		return "[" + mediaTypeOrUnknown(mediaType) + " body omitted]", false
+	}
+}
+
+// curl returns an equivalent curl command with redacted credentials
+func (m *LoggingTransport) curl(req *http.Request, body []byte) string {
+	var b strings.Builder
+	b.WriteString("curl")
+	if req.Method != http.MethodGet {
+		b.WriteString(" -X " + req.Method)
+	}
+	b.WriteString(" " + shellQuote(m.url(req.URL)))
+
+	names := make([]string, 0, len(req.Header))
+	for k := range req.Header {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	headers := m.headers(req.Header)
+	for _, k := range names {
+		b.WriteString(" -H " + shellQuote(k+": "+headers[k]))
+	}
+
+	// Omitted bodies are left out, a placeholder would be sent as the body when the command is run
+	if body != nil {
+		if content, ok := m.body(req.Header, body); ok {
+			b.WriteString(" --data-binary " + shellQuote(content))
+		}
+	}
+	return b.String()
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func mediaTypeOrUnknown(mediaType string) string {
+	if mediaType == "" {
+		return "unknown"
+	}
+	return mediaType
+}
+
+func isJsonContent(h http.Header) bool {
+	mediaType, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// dumpableResponse excludes streaming responses, reading them would block until events arrive
+func dumpableResponse(res *http.Response) bool {
+	if res.Body == nil || res.Body == http.NoBody {
+		return false
+	}
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	return mediaType != "text/event-stream"
+}
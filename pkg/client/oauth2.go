@@ -0,0 +1,242 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Token struct {
+	AccessToken  string    `json:"access_token"`
+	TokenType    string    `json:"token_type,omitempty"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	Expiry       time.Time `json:"expiry,omitempty"`
+}
+
+// Type returns the token type for the Authorization header, defaulting to Bearer
+func (t *Token) Type() string {
+	if t.TokenType == "" || strings.EqualFold(t.TokenType, "bearer") {
+		return "Bearer"
+	}
+	return t.TokenType
+}
+
+// Valid reports whether the token can still be used for at least d
+func (t *Token) Valid(d time.Duration) bool {
+	if t == nil || t.AccessToken == "" {
+		return false
+	}
+	return t.Expiry.IsZero() || time.Now().Add(d).Before(t.Expiry)
+}
+
+type TokenSource interface {
+	Token(ctx context.Context) (*Token, error)
+}
+
+type OAuth2Config struct {
+	TokenUrl     string
+	ClientId     string
+	ClientSecret string
+	Scopes       []string
+	// CredentialsInBody sends the client credentials as form parameters instead of HTTP basic authentication
+	CredentialsInBody bool
+	// RefreshBefore is the time before expiry at which the token is refreshed in the background
+	RefreshBefore time.Duration
+	// Client is used for the token requests, a client with a 30 second timeout is used when nil
+	Client *http.Client
+}
+
+// NewClientCredentialsTokenSource returns tokens obtained with the OAuth2 client credentials grant
+func NewClientCredentialsTokenSource(c OAuth2Config) *OAuth2TokenSource {
+	return newOAuth2TokenSource(c, "")
+}
+
+// NewRefreshTokenSource returns tokens obtained with the OAuth2 refresh token grant, rotated refresh tokens are used for later requests
+func NewRefreshTokenSource(c OAuth2Config, refreshToken string) *OAuth2TokenSource {
+	return newOAuth2TokenSource(c, refreshToken)
+}
+
+func newOAuth2TokenSource(c OAuth2Config, refreshToken string) *OAuth2TokenSource {
+	if c.Client == nil {
+		c.Client = NewHttpClient("go-kit-oauth2", 30, false)
+	}
+	if c.RefreshBefore <= 0 {
+		c.RefreshBefore = 30 * time.Second
+	}
+	return &OAuth2TokenSource{
+		config:       c,
+		refreshToken: refreshToken,
+	}
+}
+
+// OAuth2TokenSource caches the token until it expires.
+// Tokens close to expiry are refreshed in the background, and concurrent callers share a single token request.
+type OAuth2TokenSource struct {
+	config       OAuth2Config
+	refreshToken string
+	token        *Token
+	pending      *tokenRequest
+	mux          sync.Mutex
+}
+
+type tokenRequest struct {
+	done  chan struct{}
+	token *Token
+	err   error
+}
+
+func (s *OAuth2TokenSource) Token(ctx context.Context) (*Token, error) {
+	s.mux.Lock()
+	token := s.token
+	if token.Valid(s.config.RefreshBefore) {
+		s.mux.Unlock()
+		return token, nil
+	}
+
+	request := s.requestLocked()
+	s.mux.Unlock()
+
+	// Keep using the current token while it is refreshed in the background
+	if token.Valid(0) {
+		return token, nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-request.done:
+		return request.token, request.err
+	}
+}
+
+// Invalidate drops token from the cache, e.g. after the server rejected it
+func (s *OAuth2TokenSource) Invalidate(token *Token) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.token == token {
+		s.token = nil
+	}
+}
+
+// requestLocked returns the pending token request or starts a new one
+func (s *OAuth2TokenSource) requestLocked() *tokenRequest {
+	if s.pending != nil {
+		return s.pending
+	}
+
+	request := &tokenRequest{done: make(chan struct{})}
+	s.pending = request
+
+	go func() {
+		// The request is shared by all callers, so it does not depend on the context of any of them
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		token, err := s.fetch(ctx)
+
+		s.mux.Lock()
+		if err == nil {
+			s.token = token
+			if token.RefreshToken != "" {
+				s.refreshToken = token.RefreshToken
+			}
+		} else {
+			slog.Warn("could not obtain oauth2 token", "url", s.config.TokenUrl, "error", err)
+		}
+		s.pending = nil
+		s.mux.Unlock()
+
+		request.token, request.err = token, err
+		close(request.done)
+	}()
+	return request
+}
+
+func (s *OAuth2TokenSource) fetch(ctx context.Context) (*Token, error) {
+	form := url.Values{}
+	s.mux.Lock()
+	if s.refreshToken != "" {
+		form.Set("grant_type", "refresh_token")
+		form.Set("refresh_token", s.refreshToken)
+	} else {
+		form.Set("grant_type", "client_credentials")
+	}
+	s.mux.Unlock()
+	if len(s.config.Scopes) > 0 {
+		form.Set("scope", strings.Join(s.config.Scopes, " "))
+	}
+	if s.config.CredentialsInBody {
+		form.Set("client_id", s.config.ClientId)
+		form.Set("client_secret", s.config.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.config.TokenUrl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if !s.config.CredentialsInBody {
+		req.SetBasicAuth(url.QueryEscape(s.config.ClientId), url.QueryEscape(s.config.ClientSecret))
+	}
+
+	var res *http.Response
+	if res, err = s.config.Client.Do(req); err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var content []byte
+	if content, err = io.ReadAll(io.LimitReader(res.Body, 1<<20)); err != nil {
+		return nil, err
+	}
+
+	var body struct {
+		AccessToken      string `json:"access_token"`
+		TokenType        string `json:"token_type"`
+		RefreshToken     string `json:"refresh_token"`
+		ExpiresIn        int64  `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err = json.Unmarshal(content, &body); err != nil {
+		return nil, fmt.Errorf("%w: status %d: invalid response", ErrTokenRequest, res.StatusCode)
+	}
+	if res.StatusCode != http.StatusOK || body.Error != "" || body.AccessToken == "" {
+		return nil, fmt.Errorf("%w: status %d: %s", ErrTokenRequest, res.StatusCode, strings.TrimSpace(body.Error+" "+body.ErrorDescription))
+	}
+
+	token := &Token{
+		AccessToken:  body.AccessToken,
+		TokenType:    body.TokenType,
+		RefreshToken: body.RefreshToken,
+	}
+	if body.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(body.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
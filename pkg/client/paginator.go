@@ -0,0 +1,415 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// PageStrategy determines how the pages of a list API are requested
+type PageStrategy interface {
+	// Start prepares the query of the first page
+	Start(query url.Values, pageSize int)
+	// Next returns the url of the page following the current page, or false when it was the last page
+	Next(page Page) (*url.URL, bool, error)
+}
+
+// Page is a page received by the paginator
+type Page struct {
+	Url      *url.URL
+	Response *http.Response
+	Body     []byte
+	// Document is the decoded body, numbers are decoded as json.Number so large integers keep their literal
+	Document any
+	// Count is the number of items on the page
+	Count int
+}
+
+// LinkStrategy follows the RFC 8288 Link header with rel="next", the paginator rejects links to other origins than its base URL
+type LinkStrategy struct {
+	PageSizeParam string
+}
+
+func (s LinkStrategy) Start(query url.Values, pageSize int) {
+	setPageSize(query, s.PageSizeParam, pageSize)
+}
+
+func (s LinkStrategy) Next(page Page) (*url.URL, bool, error) {
+	next := nextLink(page.Response.Header.Values("Link"))
+	if next == "" {
+		return nil, false, nil
+	}
+	u, err := page.Url.Parse(next)
+	if err != nil {
+		return nil, false, err
+	}
+	return u, true, nil
+}
+
+// CursorStrategy passes the cursor found in the response body, e.g. "meta.next_cursor", as CursorParam of the next request
+type CursorStrategy struct {
+	CursorField   string
+	CursorParam   string
+	PageSizeParam string
+}
+
+func (s CursorStrategy) Start(query url.Values, pageSize int) {
+	setPageSize(query, s.PageSizeParam, pageSize)
+}
+
+func (s CursorStrategy) Next(page Page) (*url.URL, bool, error) {
+	// Numeric cursors are kept as their literal, large integers do not fit a float64
+	value := jsonField(page.Document, s.CursorField)
+	var cursor string
+	switch v := value.(type) {
+	case nil:
+		return nil, false, nil
+	case string:
+		cursor = v
+	case json.Number:
+		cursor = v.String()
+	default:
+		return nil, false, fmt.Errorf("cursor field %s is not a string", s.CursorField)
+	}
+	if cursor == "" {
+		return nil, false, nil
+	}
+
+	next := *page.Url
+	query := next.Query()
+	query.Set(s.CursorParam, cursor)
+	next.RawQuery = query.Encode()
+	return &next, true, nil
+}
+
+// PageNumberStrategy increments the PageParam starting at FirstPage, until a page has less items than the page size
+type PageNumberStrategy struct {
+	PageParam     string
+	PageSizeParam string
+	FirstPage     int
+}
+
+func (s PageNumberStrategy) Start(query url.Values, pageSize int) {
+	query.Set(s.PageParam, strconv.Itoa(s.FirstPage))
+	setPageSize(query, s.PageSizeParam, pageSize)
+}
+
+func (s PageNumberStrategy) Next(page Page) (*url.URL, bool, error) {
+	query := page.Url.Query()
+	if lastPage(query, s.PageSizeParam, page.Count) {
+		return nil, false, nil
+	}
+
+	number, err := strconv.Atoi(query.Get(s.PageParam))
+	if err != nil {
+		number = s.FirstPage
+	}
+	query.Set(s.PageParam, strconv.Itoa(number+1))
+
+	next := *page.Url
+	next.RawQuery = query.Encode()
+	return &next, true, nil
+}
+
+// OffsetStrategy advances the OffsetParam by the number of items received, until a page has less items than LimitParam
+type OffsetStrategy struct {
+	OffsetParam string
+	LimitParam  string
+}
+
+func (s OffsetStrategy) Start(query url.Values, pageSize int) {
+	query.Set(s.OffsetParam, "0")
+	setPageSize(query, s.LimitParam, pageSize)
+}
+
+func (s OffsetStrategy) Next(page Page) (*url.URL, bool, error) {
+	query := page.Url.Query()
+	if lastPage(query, s.LimitParam, page.Count) {
+		return nil, false, nil
+	}
+
+	offset, _ := strconv.Atoi(query.Get(s.OffsetParam))
+	query.Set(s.OffsetParam, strconv.Itoa(offset+page.Count))
+
+	next := *page.Url
+	next.RawQuery = query.Encode()
+	return &next, true, nil
+}
+
+type PaginatorOptions struct {
+	// PageSize is requested through the page size parameter of the strategy, 0 uses the default of the API
+	PageSize int
+	// MaxItems stops the iteration after this number of items, 0 means no limit
+	MaxItems int
+	// ItemsField is the field holding the items in the response body, e.g. "data.items", the body itself is the list when empty
+	ItemsField string
+	// MaxPageSize limits the size of a page body in bytes, DefaultMaxPageSize is used when 0
+	MaxPageSize int64
+}
+
+// DefaultMaxPageSize is the largest page body read when PaginatorOptions.MaxPageSize is not set
+const DefaultMaxPageSize = 10 << 20
+
+// NewPaginator iterates the items of the list API at path, requesting pages as determined by s
+func NewPaginator[T any](c *RestClient, path string, query url.Values, s PageStrategy, o PaginatorOptions) *Paginator[T] {
+	q := make(url.Values, len(query))
+	for k, v := range query {
+		q[k] = append([]string(nil), v...)
+	}
+	s.Start(q, o.PageSize)
+	if o.MaxPageSize <= 0 {
+		o.MaxPageSize = DefaultMaxPageSize
+	}
+
+	return &Paginator[T]{
+		client:   c,
+		strategy: s,
+		options:  o,
+		next:     c.url(path, q),
+		visited:  make(map[string]struct{}),
+	}
+}
+
+// Paginator fetches pages on demand while iterating with Next and Item:
+//
+//	for p.Next(ctx) {
+//		item := p.Item()
+//	}
+//	if err := p.Err(); err != nil {
+//	}
+type Paginator[T any] struct {
+	client   *RestClient
+	strategy PageStrategy
+	options  PaginatorOptions
+	next     *url.URL
+	visited  map[string]struct{}
+	items    []T
+	item     T
+	count    int
+	pages    int
+	err      error
+}
+
+// Next advances to the next item, fetching the next page when needed. It returns false at the end or on error.
+func (p *Paginator[T]) Next(ctx context.Context) bool {
+	if p.err != nil {
+		return false
+	}
+	if p.options.MaxItems > 0 && p.count >= p.options.MaxItems {
+		return false
+	}
+
+	// Pages may be empty while more pages follow
+	for len(p.items) == 0 {
+		if p.next == nil {
+			return false
+		}
+		if p.err = ctx.Err(); p.err != nil {
+			return false
+		}
+		if p.err = p.fetch(ctx); p.err != nil {
+			return false
+		}
+	}
+
+	p.item = p.items[0]
+	p.items = p.items[1:]
+	p.count++
+	return true
+}
+
+func (p *Paginator[T]) Item() T {
+	return p.item
+}
+
+func (p *Paginator[T]) Err() error {
+	return p.err
+}
+
+// Pages returns the number of pages fetched so far
+func (p *Paginator[T]) Pages() int {
+	return p.pages
+}
+
+// All collects the remaining items
+func (p *Paginator[T]) All(ctx context.Context) ([]T, error) {
+	var output []T
+	for p.Next(ctx) {
+		output = append(output, p.Item())
+	}
+	return output, p.Err()
+}
+
+func (p *Paginator[T]) fetch(ctx context.Context) error {
+	req, err := p.client.newRequest(ctx, http.MethodGet, p.next, nil)
+	if err != nil {
+		return err
+	}
+
+	var res *http.Response
+	if res, err = p.client.Client.Do(req); err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= http.StatusBadRequest {
+		return newAPIError(req, res)
+	}
+
+	var body []byte
+	if body, err = io.ReadAll(io.LimitReader(res.Body, p.options.MaxPageSize+1)); err != nil {
+		return err
+	}
+	if int64(len(body)) > p.options.MaxPageSize {
+		return fmt.Errorf("%s: %w", req.URL.Redacted(), ErrPageTooLarge)
+	}
+	p.visited[req.URL.String()] = struct{}{}
+
+	// The body is decoded once, the strategy reads its cursor from the same document
+	var document any
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err = decoder.Decode(&document); err != nil {
+		return fmt.Errorf("could not decode page %s: %w", req.URL.Redacted(), err)
+	}
+
+	var items []T
+	if items, err = decodeItems[T](document, p.options.ItemsField); err != nil {
+		return fmt.Errorf("could not decode page %s: %w", req.URL.Redacted(), err)
+	}
+
+	var (
+		next *url.URL
+		more bool
+	)
+	page := Page{
+		Url:      req.URL,
+		Response: res,
+		Body:     body,
+		Document: document,
+		Count:    len(items),
+	}
+	if next, more, err = p.strategy.Next(page); err != nil {
+		return err
+	}
+	switch {
+	case !more:
+		next = nil
+	case !strings.EqualFold(next.Scheme, p.client.BaseUrl.Scheme) || !strings.EqualFold(next.Host, p.client.BaseUrl.Host):
+		return fmt.Errorf("%s: %w", next.Redacted(), ErrPageHostMismatch)
+	default:
+		// An API repeating its cursor or link would otherwise be requested forever
+		if _, found := p.visited[next.String()]; found {
+			next = nil
+		}
+	}
+
+	p.items = items
+	p.next = next
+	p.pages++
+	return nil
+}
+
+// decodeItems converts the list in field of document, or document itself when field is empty, to the item type
+func decodeItems[T any](document any, field string) ([]T, error) {
+	value := document
+	if field != "" {
+		value = jsonField(document, field)
+	}
+	if value == nil {
+		return nil, nil
+	}
+
+	content, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var items []T
+	err = json.Unmarshal(content, &items)
+	return items, err
+}
+
+// jsonField returns the value at the dot separated path in document
+func jsonField(document any, path string) any {
+	for _, name := range strings.Split(path, ".") {
+		object, ok := document.(map[string]any)
+		if !ok {
+			return nil
+		}
+		document = object[name]
+	}
+	return document
+}
+
+// nextLink returns the target of the rel="next" link in Link header values
+func nextLink(values []string) string {
+	for _, value := range values {
+		for {
+			open := strings.IndexByte(value, '<')
+			if open < 0 {
+				break
+			}
+			closing := strings.IndexByte(value[open:], '>')
+			if closing < 0 {
+				break
+			}
+			target := value[open+1 : open+closing]
+			value = value[open+closing+1:]
+
+			// The parameters of this link end where the next link starts
+			params := value
+			if next := strings.IndexByte(value, '<'); next >= 0 {
+				params = value[:next]
+			}
+			for _, param := range strings.Split(params, ";") {
+				name, v, _ := strings.Cut(strings.Trim(strings.TrimSpace(param), ","), "=")
+				if !strings.EqualFold(strings.TrimSpace(name), "rel") {
+					continue
+				}
+				for _, rel := range strings.Fields(strings.Trim(strings.TrimSpace(v), `",`)) {
+					if strings.EqualFold(rel, "next") {
+						return target
+					}
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func setPageSize(query url.Values, param string, pageSize int) {
+	if param != "" && pageSize > 0 {
+		query.Set(param, strconv.Itoa(pageSize))
+	}
+}
+
+// lastPage reports whether a page with count items was the last one, based on the requested page size
+func lastPage(query url.Values, param string, count int) bool {
+	if count == 0 {
+		return true
+	}
+	size, err := strconv.Atoi(query.Get(param))
+	return err == nil && count < size
+}
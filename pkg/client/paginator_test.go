@@ -0,0 +1,189 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPaginator(t *testing.T) {
+	tests := []struct {
+		name     string
+		handler  func(w http.ResponseWriter, r *http.Request)
+		strategy PageStrategy
+		options  PaginatorOptions
+		want     []int
+		pages    int
+		err      error
+	}{
+		{
+			name: "link header",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Query().Get("page") {
+				case "":
+					w.Header().Set("Link", `</items?page=2>; rel="next"`)
+					_, _ = w.Write([]byte(`[1,2]`))
+				case "2":
+					_, _ = w.Write([]byte(`[3]`))
+				}
+			},
+			strategy: LinkStrategy{},
+			want:     []int{1, 2, 3},
+			pages:    2,
+		},
+		{
+			name: "link header pointing to the current page",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Link", `</items>; rel="next"`)
+				_, _ = w.Write([]byte(`[]`))
+			},
+			strategy: LinkStrategy{},
+			want:     nil,
+			pages:    1,
+		},
+		{
+			name: "link header pointing to another host",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Link", `<https://example.com/items?page=2>; rel="next"`)
+				_, _ = w.Write([]byte(`[1]`))
+			},
+			strategy: LinkStrategy{},
+			want:     nil,
+			pages:    0,
+			err:      ErrPageHostMismatch,
+		},
+		{
+			name: "link header switching the scheme",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Link", `<https://`+r.Host+`/items?page=2>; rel="next"`)
+				_, _ = w.Write([]byte(`[1]`))
+			},
+			strategy: LinkStrategy{},
+			want:     nil,
+			pages:    0,
+			err:      ErrPageHostMismatch,
+		},
+		{
+			name: "numeric cursor",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Query().Get("cursor") {
+				case "":
+					_, _ = w.Write([]byte(`{"items":[1],"next":12345678901234567890}`))
+				case "12345678901234567890":
+					_, _ = w.Write([]byte(`{"items":[2],"next":null}`))
+				}
+			},
+			strategy: CursorStrategy{CursorField: "next", CursorParam: "cursor"},
+			options:  PaginatorOptions{ItemsField: "items"},
+			want:     []int{1, 2},
+			pages:    2,
+		},
+		{
+			name: "repeated cursor",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(`{"items":[],"next":"same"}`))
+			},
+			strategy: CursorStrategy{CursorField: "next", CursorParam: "cursor"},
+			options:  PaginatorOptions{ItemsField: "items"},
+			want:     nil,
+			pages:    2,
+		},
+		{
+			name: "page number",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+				items := map[int]string{1: `[1,2]`, 2: `[3,4]`, 3: `[5]`}[page]
+				_, _ = w.Write([]byte(items))
+			},
+			strategy: PageNumberStrategy{PageParam: "page", PageSizeParam: "size", FirstPage: 1},
+			options:  PaginatorOptions{PageSize: 2},
+			want:     []int{1, 2, 3, 4, 5},
+			pages:    3,
+		},
+		{
+			name: "offset with maximum items",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+				_, _ = w.Write([]byte("[" + strconv.Itoa(offset+1) + "," + strconv.Itoa(offset+2) + "]"))
+			},
+			strategy: OffsetStrategy{OffsetParam: "offset", LimitParam: "limit"},
+			options:  PaginatorOptions{PageSize: 2, MaxItems: 5},
+			want:     []int{1, 2, 3, 4, 5},
+			pages:    3,
+		},
+		{
+			name: "page exceeding the maximum size",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte("[" + strings.Repeat("1,", 100) + "1]"))
+			},
+			strategy: LinkStrategy{},
+			options:  PaginatorOptions{MaxPageSize: 64},
+			want:     nil,
+			pages:    0,
+			err:      ErrPageTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(tt.handler))
+			defer server.Close()
+
+			c, err := NewRestClient(server.Client(), server.URL)
+			if err != nil {
+				t.Fatalf("NewRestClient() error = %v", err)
+			}
+
+			p := NewPaginator[int](c, "/items", url.Values{}, tt.strategy, tt.options)
+			items, err := p.All(context.Background())
+			if !errors.Is(err, tt.err) {
+				t.Errorf("All() error = %v, want %v", err, tt.err)
+			}
+			if !reflect.DeepEqual(items, tt.want) {
+				t.Errorf("All() = %v, want %v", items, tt.want)
+			}
+			if p.Pages() != tt.pages {
+				t.Errorf("Pages() = %d, want %d", p.Pages(), tt.pages)
+			}
+		})
+	}
+}
+
+func TestNextLink(t *testing.T) {
+	tests := []struct {
+		values []string
+		want   string
+	}{
+		{values: []string{`<https://a/2>; rel="next"`}, want: "https://a/2"},
+		{values: []string{`<https://a/1>; rel="prev", <https://a/3>; rel="next"`}, want: "https://a/3"},
+		{values: []string{`<https://a/1>; rel="prev"`, `<https://a/3>; rel="last next"`}, want: "https://a/3"},
+		{values: []string{`<https://a/1>; rel="prev"`}, want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := nextLink(tt.values); got != tt.want {
+			t.Errorf("nextLink(%q) = %q, want %q", tt.values, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// WithProxy sends requests through the proxy at proxyUrl, credentials are taken from its user info.
+// The http, https, socks5 and socks5h schemes are supported, hosts matching noProxy are connected directly.
+// Host names are resolved locally for socks5 and by the proxy for socks5h.
+func WithProxy(proxyUrl string, noProxy ...string) HttpClientOption {
+	return func(c *httpClientConfig) error {
+		u, err := url.Parse(proxyUrl)
+		if err != nil {
+			return err
+		}
+		bypass := NewNoProxyMatcher(noProxy...)
+
+		switch u.Scheme {
+		case "http", "https":
+			c.transport.Proxy = func(req *http.Request) (*url.URL, error) {
+				if bypass.Match(requestAddress(req.URL)) {
+					return nil, nil
+				}
+				return u, nil
+			}
+		case "socks5", "socks5h":
+			password, _ := u.User.Password()
+			socks := NewSocks5Dialer(u.Host, u.User.Username(), password, c.dialer)
+			socks.ResolveLocally = u.Scheme == "socks5"
+			direct := c.dialer
+			c.transport.Proxy = nil
+			c.transport.DialContext = func(ctx context.Context, network string, address string) (net.Conn, error) {
+				if bypass.Match(address) {
+					return direct.DialContext(ctx, network, address)
+				}
+				return socks.DialContext(ctx, network, address)
+			}
+		default:
+			return fmt.Errorf("%w: %q", ErrProxySchemeUnsupported, u.Scheme)
+		}
+		return nil
+	}
+}
+
+// WithoutProxy connects directly to all hosts, ignoring the proxy environment variables
+func WithoutProxy() HttpClientOption {
+	return func(c *httpClientConfig) error {
+		c.transport.Proxy = nil
+		return nil
+	}
+}
+
+// requestAddress returns the host and port of u, using the default port of its scheme when it has none
+func requestAddress(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	port := "80"
+	if u.Scheme == "https" || u.Scheme == "wss" {
+		port = "443"
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// NewNoProxyMatcher parses NO_PROXY style patterns: "*", IP addresses, CIDR ranges and domain names, optionally with a port.
+// A domain matches itself and all its subdomains, a leading dot or "*." is ignored.
+func NewNoProxyMatcher(patterns ...string) *NoProxyMatcher {
+	m := &NoProxyMatcher{}
+
+	for _, value := range patterns {
+		for _, p := range strings.Split(value, ",") {
+			p = strings.ToLower(strings.TrimSpace(p))
+			if p == "" {
+				continue
+			}
+			if p == "*" {
+				m.all = true
+				continue
+			}
+			if _, network, err := net.ParseCIDR(p); err == nil {
+				m.networks = append(m.networks, network)
+				continue
+			}
+
+			var port string
+			if host, hostPort, err := net.SplitHostPort(p); err == nil {
+				p, port = host, hostPort
+			}
+			if ip := net.ParseIP(p); ip != nil {
+				m.ips = append(m.ips, noProxyIp{ip: ip, port: port})
+				continue
+			}
+			p = strings.TrimPrefix(strings.TrimPrefix(p, "*"), ".")
+			m.domains = append(m.domains, noProxyDomain{domain: p, port: port})
+		}
+	}
+	return m
+}
+
+type NoProxyMatcher struct {
+	all      bool
+	networks []*net.IPNet
+	ips      []noProxyIp
+	domains  []noProxyDomain
+}
+
+type noProxyIp struct {
+	ip   net.IP
+	port string
+}
+
+type noProxyDomain struct {
+	domain string
+	port   string
+}
+
+// Match reports whether a connection to address, a host with optional port, should bypass the proxy
+func (m *NoProxyMatcher) Match(address string) bool {
+	if m.all {
+		return true
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	host = strings.ToLower(strings.TrimSuffix(strings.Trim(host, "[]"), "."))
+
+	if ip := net.ParseIP(host); ip != nil {
+		for _, n := range m.networks {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+		for _, i := range m.ips {
+			if i.ip.Equal(ip) && (i.port == "" || i.port == port) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, d := range m.domains {
+		if d.port != "" && d.port != port {
+			continue
+		}
+		if host == d.domain || strings.HasSuffix(host, "."+d.domain) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package client
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// RedirectPolicy controls which redirects are followed by the client
+type RedirectPolicy struct {
+	// MaxHops is the maximum number of redirects followed for a single request, 0 uses the default of 10
+	MaxHops int
+	// SameHostOnly returns redirects to a host other than the one of the original request to the caller instead of following them
+	SameHostOnly bool
+	// StripAuthCrossHost removes credentials when a redirect leaves the host of the original request, including redirects to subdomains
+	StripAuthCrossHost bool
+}
+
+func DefaultRedirectPolicy() RedirectPolicy {
+	return RedirectPolicy{
+		MaxHops:            10,
+		StripAuthCrossHost: true,
+	}
+}
+
+func (p RedirectPolicy) checkRedirect(req *http.Request, via []*http.Request) error {
+	maxHops := p.MaxHops
+	if maxHops <= 0 {
+		maxHops = DefaultRedirectPolicy().MaxHops
+	}
+	if len(via) > maxHops {
+		return fmt.Errorf("stopped after %d redirects: %w", maxHops, ErrTooManyRedirects)
+	}
+
+	// The headers of every redirect are copied from the original request, so its host is the one which may receive them
+	if req.URL.Host == via[0].URL.Host {
+		return nil
+	}
+	if p.SameHostOnly {
+		return http.ErrUseLastResponse
+	}
+	if p.StripAuthCrossHost {
+		req.Header.Del("Authorization")
+		req.Header.Del("Proxy-Authorization")
+		req.Header.Del("Cookie")
+	}
+	return nil
+}
@@ -0,0 +1,339 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// NewRestClient creates a client for the JSON API at the absolute http or https baseUrl, c is used for all requests
+func NewRestClient(c *http.Client, baseUrl string) (*RestClient, error) {
+	u, err := url.Parse(baseUrl)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidBaseUrl, u.Redacted())
+	}
+	if c == nil {
+		c = NewHttpClient("go-kit-rest", 30, true)
+	}
+	return &RestClient{
+		Client:  c,
+		BaseUrl: u,
+		Header:  make(http.Header),
+	}, nil
+}
+
+// RestClient sends JSON requests relative to BaseUrl with Header added to every request
+type RestClient struct {
+	Client  *http.Client
+	BaseUrl *url.URL
+	Header  http.Header
+}
+
+// Do sends body as JSON to path, which is joined with the base path and must be escaped, and decodes the response into result.
+// Responses with a status of 400 or higher are returned as *APIError, nil body and result values are skipped.
+func (c *RestClient) Do(ctx context.Context, method string, path string, query url.Values, body any, result any) error {
+	req, err := c.NewRequest(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+
+	var res *http.Response
+	if res, err = c.Client.Do(req); err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= http.StatusBadRequest {
+		return newAPIError(req, res)
+	}
+	if result == nil || res.StatusCode == http.StatusNoContent || req.Method == http.MethodHead {
+		_, _ = io.Copy(io.Discard, res.Body)
+		return nil
+	}
+
+	if err = json.NewDecoder(res.Body).Decode(result); err != nil && err != io.EOF {
+		return fmt.Errorf("could not decode response of %s %s: %w", req.Method, req.URL.Redacted(), err)
+	}
+	return nil
+}
+
+// NewRequest builds the request sent by Do
+func (c *RestClient) NewRequest(ctx context.Context, method string, path string, query url.Values, body any) (*http.Request, error) {
+	return c.newRequest(ctx, method, c.url(path, query), body)
+}
+
+func (c *RestClient) url(path string, query url.Values) *url.URL {
+	u := c.BaseUrl.JoinPath(path)
+	if len(query) > 0 {
+		u.RawQuery = query.Encode()
+	}
+	return u
+}
+
+func (c *RestClient) newRequest(ctx context.Context, method string, u *url.URL, body any) (*http.Request, error) {
+	// A nil pointer wrapped in body would otherwise be sent as null
+	if v := reflect.ValueOf(body); v.Kind() == reflect.Pointer && v.IsNil() {
+		body = nil
+	}
+
+	var reader io.Reader
+	if body != nil {
+		content, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(content)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), reader)
+	if err != nil {
+		return nil, err
+	}
+	if c.Header != nil {
+		req.Header = c.Header.Clone()
+	}
+	req.Header.Set("Accept", "application/json, application/problem+json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+func Get[T any](ctx context.Context, c *RestClient, path string, query url.Values) (T, error) {
+	var result T
+	err := c.Do(ctx, http.MethodGet, path, query, nil, &result)
+	return result, err
+}
+
+func Post[Req any, Resp any](ctx context.Context, c *RestClient, path string, body Req) (Resp, error) {
+	var result Resp
+	err := c.Do(ctx, http.MethodPost, path, nil, body, &result)
+	return result, err
+}
+
+func Put[Req any, Resp any](ctx context.Context, c *RestClient, path string, body Req) (Resp, error) {
+	var result Resp
+	err := c.Do(ctx, http.MethodPut, path, nil, body, &result)
+	return result, err
+}
+
+func Patch[Req any, Resp any](ctx context.Context, c *RestClient, path string, body Req) (Resp, error) {
+	var result Resp
+	err := c.Do(ctx, http.MethodPatch, path, nil, body, &result)
+	return result, err
+}
+
+func Delete(ctx context.Context, c *RestClient, path string) error {
+	return c.Do(ctx, http.MethodDelete, path, nil, nil, nil)
+}
+
+// Problem holds the RFC 9457 problem details returned by an API
+type Problem struct {
+	Type       string         `json:"type,omitempty"`
+	Title      string         `json:"title,omitempty"`
+	Status     int            `json:"status,omitempty"`
+	Detail     string         `json:"detail,omitempty"`
+	Instance   string         `json:"instance,omitempty"`
+	Extensions map[string]any `json:"-"`
+}
+
+// APIError is returned for responses with a status of 400 or higher
+type APIError struct {
+	Method     string
+	Url        string
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	// Problem is decoded from problem+json bodies, and filled from the message of other JSON error bodies
+	Problem *Problem
+}
+
+func (e *APIError) Error() string {
+	message := fmt.Sprintf("%s %s: %d %s", e.Method, e.Url, e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Problem != nil {
+		if e.Problem.Title != "" && e.Problem.Title != http.StatusText(e.StatusCode) {
+			message += ": " + e.Problem.Title
+		}
+		if e.Problem.Detail != "" {
+			message += ": " + e.Problem.Detail
+		}
+	}
+	return message
+}
+
+// IsStatus reports whether err is an *APIError with status code
+func IsStatus(err error, code int) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == code
+}
+
+func newAPIError(req *http.Request, res *http.Response) *APIError {
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	e := &APIError{
+		Method:     req.Method,
+		Url:        req.URL.Redacted(),
+		StatusCode: res.StatusCode,
+		Header:     res.Header,
+		Body:       body,
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	switch {
+	case mediaType == "application/problem+json":
+		var fields map[string]any
+		if err := json.Unmarshal(body, &fields); err != nil {
+			return e
+		}
+		p := &Problem{
+			Extensions: make(map[string]any),
+		}
+		for k, v := range fields {
+			switch k {
+			case "type":
+				p.Type, _ = v.(string)
+			case "title":
+				p.Title, _ = v.(string)
+			case "status":
+				if status, ok := v.(float64); ok {
+					p.Status = int(status)
+				}
+			case "detail":
+				p.Detail, _ = v.(string)
+			case "instance":
+				p.Instance, _ = v.(string)
+			default:
+				p.Extensions[k] = v
+			}
+		}
+		e.Problem = p
+	case isJsonContent(res.Header):
+		var fields struct {
+			Message          string `json:"message"`
+			Error            string `json:"error"`
+			ErrorDescription string `json:"error_description"`
+		}
+		if err := json.Unmarshal(body, &fields); err != nil {
+			return e
+		}
+		detail := fields.Message
+		if detail == "" {
+			detail = fields.ErrorDescription
+		}
+		if detail == "" {
+			detail = fields.Error
+		}
+		if detail != "" {
+			e.Problem = &Problem{Status: res.StatusCode, Detail: detail}
+		}
+	}
+	return e
+}
+
+// NewQuery returns a builder for query parameters
+func NewQuery() Query {
+	return Query{values: make(url.Values)}
+}
+
+// Query builds query parameters, the zero value is ready to use as long as the returned Query is kept
+type Query struct {
+	values url.Values
+}
+
+// Set replaces the parameter, times are formatted as RFC 3339 and other values with their default format
+func (q Query) Set(key string, value any) Query {
+	if q.values == nil {
+		q.values = make(url.Values)
+	}
+	q.values.Set(key, formatQueryValue(value))
+	return q
+}
+
+func (q Query) Add(key string, value any) Query {
+	if q.values == nil {
+		q.values = make(url.Values)
+	}
+	q.values.Add(key, formatQueryValue(value))
+	return q
+}
+
+// SetNonZero only sets the parameter when value is not the zero value of its type
+func (q Query) SetNonZero(key string, value any) Query {
+	switch v := value.(type) {
+	case nil:
+		return q
+	case string:
+		if v == "" {
+			return q
+		}
+	case int:
+		if v == 0 {
+			return q
+		}
+	case int64:
+		if v == 0 {
+			return q
+		}
+	case bool:
+		if !v {
+			return q
+		}
+	case time.Time:
+		if v.IsZero() {
+			return q
+		}
+	}
+	return q.Set(key, value)
+}
+
+func (q Query) Values() url.Values {
+	return q.values
+}
+
+func formatQueryValue(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case time.Duration:
+		return v.String()
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,255 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewRestClient(t *testing.T) {
+	tests := []struct {
+		baseUrl string
+		err     error
+	}{
+		{baseUrl: "https://api.example.com/v1"},
+		{baseUrl: "http://localhost:8080"},
+		{baseUrl: "/v1", err: ErrInvalidBaseUrl},
+		{baseUrl: "api.example.com/v1", err: ErrInvalidBaseUrl},
+		{baseUrl: "ftp://api.example.com", err: ErrInvalidBaseUrl},
+		{baseUrl: "https:///v1", err: ErrInvalidBaseUrl},
+	}
+
+	for _, tt := range tests {
+		if _, err := NewRestClient(nil, tt.baseUrl); !errors.Is(err, tt.err) {
+			t.Errorf("NewRestClient(%q) error = %v, want %v", tt.baseUrl, err, tt.err)
+		}
+	}
+}
+
+type testItem struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestRestClientRoundTrip(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "application/json, application/problem+json" {
+			t.Errorf("Accept = %q", r.Header.Get("Accept"))
+		}
+		if r.Header.Get("X-Tenant") != "acme" {
+			t.Errorf("X-Tenant = %q, want %q", r.Header.Get("X-Tenant"), "acme")
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/api/items/1":
+			_ = json.NewEncoder(w).Encode(testItem{Id: 1, Name: r.URL.Query().Get("name")})
+		case r.Method == http.MethodPost && r.URL.Path == "/api/items":
+			if r.Header.Get("Content-Type") != "application/json" {
+				t.Errorf("Content-Type = %q, want %q", r.Header.Get("Content-Type"), "application/json")
+			}
+			var item testItem
+			if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
+				t.Errorf("decode request: %v", err)
+			}
+			item.Id = 2
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(item)
+		case r.Method == http.MethodDelete && r.URL.Path == "/api/items/2":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c, err := NewRestClient(server.Client(), server.URL+"/api")
+	if err != nil {
+		t.Fatalf("NewRestClient() error = %v", err)
+	}
+	c.Header.Set("X-Tenant", "acme")
+	ctx := context.Background()
+
+	got, err := Get[testItem](ctx, c, "/items/1", NewQuery().Set("name", "first").Values())
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if want := (testItem{Id: 1, Name: "first"}); got != want {
+		t.Errorf("Get() = %+v, want %+v", got, want)
+	}
+
+	created, err := Post[testItem, testItem](ctx, c, "/items", testItem{Name: "second"})
+	if err != nil {
+		t.Fatalf("Post() error = %v", err)
+	}
+	if want := (testItem{Id: 2, Name: "second"}); created != want {
+		t.Errorf("Post() = %+v, want %+v", created, want)
+	}
+
+	if err = Delete(ctx, c, "/items/2"); err != nil {
+		t.Errorf("Delete() error = %v", err)
+	}
+	if err = Delete(ctx, c, "/items/3"); !IsStatus(err, http.StatusNotFound) {
+		t.Errorf("Delete() error = %v, want status %d", err, http.StatusNotFound)
+	}
+}
+
+func TestRestClientErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		status      int
+		body        string
+		problem     *Problem
+	}{
+		{
+			name:        "problem details",
+			contentType: "application/problem+json",
+			status:      http.StatusUnprocessableEntity,
+			body:        `{"type":"https://example.com/invalid","title":"Invalid item","status":422,"detail":"name is required","instance":"/items","field":"name"}`,
+			problem: &Problem{
+				Type:       "https://example.com/invalid",
+				Title:      "Invalid item",
+				Status:     http.StatusUnprocessableEntity,
+				Detail:     "name is required",
+				Instance:   "/items",
+				Extensions: map[string]any{"field": "name"},
+			},
+		},
+		{
+			name:        "json message",
+			contentType: "application/json; charset=utf-8",
+			status:      http.StatusConflict,
+			body:        `{"message":"item exists"}`,
+			problem:     &Problem{Status: http.StatusConflict, Detail: "item exists"},
+		},
+		{
+			name:        "oauth2 error",
+			contentType: "application/json",
+			status:      http.StatusBadRequest,
+			body:        `{"error":"invalid_request","error_description":"missing scope"}`,
+			problem:     &Problem{Status: http.StatusBadRequest, Detail: "missing scope"},
+		},
+		{
+			name:        "plain text",
+			contentType: "text/plain",
+			status:      http.StatusInternalServerError,
+			body:        "internal error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.WriteHeader(tt.status)
+				_, _ = io.WriteString(w, tt.body)
+			}))
+			defer server.Close()
+
+			c, err := NewRestClient(server.Client(), server.URL)
+			if err != nil {
+				t.Fatalf("NewRestClient() error = %v", err)
+			}
+
+			_, err = Get[testItem](context.Background(), c, "/items", nil)
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("Get() error = %v, want *APIError", err)
+			}
+			if apiErr.StatusCode != tt.status {
+				t.Errorf("StatusCode = %d, want %d", apiErr.StatusCode, tt.status)
+			}
+			if string(apiErr.Body) != tt.body {
+				t.Errorf("Body = %q, want %q", apiErr.Body, tt.body)
+			}
+			if !reflect.DeepEqual(apiErr.Problem, tt.problem) {
+				t.Errorf("Problem = %+v, want %+v", apiErr.Problem, tt.problem)
+			}
+		})
+	}
+}
+
+type testStringer struct{}
+
+func (testStringer) String() string {
+	return "stringer"
+}
+
+func TestQuery(t *testing.T) {
+	var zero Query
+	zero = zero.Set("q", "go").Add("tag", "a").Add("tag", "b")
+
+	tests := []struct {
+		name  string
+		query Query
+		want  url.Values
+	}{
+		{
+			name:  "zero value",
+			query: zero,
+			want:  url.Values{"q": {"go"}, "tag": {"a", "b"}},
+		},
+		{
+			name: "formatted values",
+			query: NewQuery().
+				Set("int", 42).
+				Set("int64", int64(-7)).
+				Set("bool", true).
+				Set("time", time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)).
+				Set("duration", 90*time.Second).
+				Set("stringer", testStringer{}).
+				Set("float", 1.5),
+			want: url.Values{
+				"int":      {"42"},
+				"int64":    {"-7"},
+				"bool":     {"true"},
+				"time":     {"2024-01-02T15:04:05Z"},
+				"duration": {"1m30s"},
+				"stringer": {"stringer"},
+				"float":    {"1.5"},
+			},
+		},
+		{
+			name: "non-zero values",
+			query: NewQuery().
+				SetNonZero("empty", "").
+				SetNonZero("zero", 0).
+				SetNonZero("false", false).
+				SetNonZero("time", time.Time{}).
+				SetNonZero("nil", nil).
+				SetNonZero("set", "value"),
+			want: url.Values{"set": {"value"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.query.Values(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Values() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+type RetryOptions struct {
+	// MaxAttempts is the total number of attempts including the first request, 1 disables retries
+	MaxAttempts      int
+	BaseDelay        time.Duration
+	MaxDelay         time.Duration
+	RetryStatusCodes []int
+	// RetryAllMethods also retries non-idempotent requests, by default POST and PATCH are only retried when they carry an Idempotency-Key header
+	RetryAllMethods bool
+}
+
+func DefaultRetryOptions() RetryOptions {
+	return RetryOptions{
+		MaxAttempts:      3,
+		BaseDelay:        100 * time.Millisecond,
+		MaxDelay:         10 * time.Second,
+		RetryStatusCodes: []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	}
+}
+
+// NewRetryTransport creates a transport retrying requests sent through t, zero values in o are replaced by their defaults
+func NewRetryTransport(t http.RoundTripper, o RetryOptions) *RetryTransport {
+	if t == nil {
+		t = http.DefaultTransport
+	}
+
+	defaults := DefaultRetryOptions()
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = defaults.MaxAttempts
+	}
+	if o.BaseDelay <= 0 {
+		o.BaseDelay = defaults.BaseDelay
+	}
+	if o.MaxDelay <= 0 {
+		o.MaxDelay = defaults.MaxDelay
+	}
+	if o.RetryStatusCodes == nil {
+		o.RetryStatusCodes = defaults.RetryStatusCodes
+	}
+	return &RetryTransport{
+		T:       t,
+		Options: o,
+	}
+}
+
+// RetryTransport retries requests failing with a connection error or a retryable status code.
+// The delay between attempts grows exponentially with full jitter, unless the server sends a Retry-After header.
+// Requests with a body are only retried when the body can be replayed through Request.GetBody.
+type RetryTransport struct {
+	T       http.RoundTripper
+	Options RetryOptions
+}
+
+func (m *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !m.retryable(req) {
+		return m.T.RoundTrip(req)
+	}
+
+	ctx := req.Context()
+	attempt := req
+	for i := 1; ; i++ {
+		res, err := m.T.RoundTrip(attempt)
+		if i >= m.Options.MaxAttempts || !m.shouldRetry(ctx, res, err) {
+			return res, err
+		}
+
+		delay := m.backoff(i)
+		if res != nil {
+			if retryAfter, ok := parseRetryAfter(res.Header.Get("Retry-After")); ok {
+				if retryAfter > m.Options.MaxDelay {
+					return res, err
+				}
+				delay = retryAfter
+			}
+		}
+		// Give up when the next attempt cannot start before the deadline
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			return res, err
+		}
+
+		if res != nil {
+			_, _ = io.CopyN(io.Discard, res.Body, 4096)
+			_ = res.Body.Close()
+		}
+		slog.Debug("retrying request", "method", req.Method, "url", req.URL.Redacted(), "attempt", i+1, "delay", delay, "status", statusOf(res), "error", err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		attempt = req.Clone(ctx)
+		if req.Body != nil && req.Body != http.NoBody {
+			if attempt.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func (m *RetryTransport) retryable(req *http.Request) bool {
+	if m.Options.MaxAttempts <= 1 {
+		return false
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return m.Options.RetryAllMethods || req.Header.Get("Idempotency-Key") != ""
+	}
+}
+
+func (m *RetryTransport) shouldRetry(ctx context.Context, res *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		return isConnectionError(err)
+	}
+	return slices.Contains(m.Options.RetryStatusCodes, res.StatusCode)
+}
+
+// backoff returns a random delay between 0 and the exponential backoff for attempt, capped at MaxDelay
+func (m *RetryTransport) backoff(attempt int) time.Duration {
+	limit := m.Options.MaxDelay
+	if attempt < 32 {
+		if d := m.Options.BaseDelay << (attempt - 1); d > 0 && d < limit {
+			limit = d
+		}
+	}
+	if limit <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int64N(int64(limit) + 1))
+}
+
+func isConnectionError(err error) bool {
+	var certErr *tls.CertificateVerificationError
+	if errors.As(err, &certErr) {
+		return false
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	// Unknown hosts and invalid addresses fail again on every attempt
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return !dnsErr.IsNotFound && (dnsErr.IsTimeout || dnsErr.IsTemporary)
+	}
+	var addrErr *net.AddrError
+	if errors.As(err, &addrErr) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// parseRetryAfter parses the delay in seconds or the HTTP date of a Retry-After header
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+func statusOf(res *http.Response) int {
+	if res == nil {
+		return 0
+	}
+	return res.StatusCode
+}
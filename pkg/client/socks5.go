@@ -0,0 +1,263 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package client
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// NewSocks5Dialer creates a dialer connecting through the SOCKS5 proxy at address, username and password are optional.
+// Host names are resolved by the proxy unless ResolveLocally is set.
+func NewSocks5Dialer(address string, username string, password string, forward *net.Dialer) *Socks5Dialer {
+	if forward == nil {
+		forward = &net.Dialer{}
+	}
+	return &Socks5Dialer{
+		Address:  address,
+		Username: username,
+		Password: password,
+		Forward:  forward,
+	}
+}
+
+type Socks5Dialer struct {
+	Address  string
+	Username string
+	Password string
+	Forward  *net.Dialer
+	// ResolveLocally resolves host names before connecting, so the proxy only receives IP addresses
+	ResolveLocally bool
+}
+
+const (
+	socks5Version         = 0x05
+	socks5AuthNone        = 0x00
+	socks5AuthPassword    = 0x02
+	socks5AuthUnavailable = 0xff
+	socks5CommandConnect  = 0x01
+	socks5AddressIpv4     = 0x01
+	socks5AddressDomain   = 0x03
+	socks5AddressIpv6     = 0x04
+)
+
+func (d *Socks5Dialer) DialContext(ctx context.Context, network string, address string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, fmt.Errorf("socks5: unsupported network %s", network)
+	}
+
+	if d.ResolveLocally {
+		var err error
+		if address, err = d.resolve(ctx, network, address); err != nil {
+			return nil, err
+		}
+	}
+
+	conn, err := d.Forward.DialContext(ctx, "tcp", d.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	// Abort the handshake when ctx is cancelled
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Unix(1, 0))
+	})
+
+	err = d.handshake(conn, address)
+	if !stop() && err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// resolve replaces the host name in address by its first IP address matching network
+func (d *Socks5Dialer) resolve(ctx context.Context, network string, address string) (string, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", err
+	}
+	if net.ParseIP(host) != nil {
+		return address, nil
+	}
+
+	resolver := d.Forward.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	ipNetwork := "ip"
+	switch network {
+	case "tcp4":
+		ipNetwork = "ip4"
+	case "tcp6":
+		ipNetwork = "ip6"
+	}
+
+	var ips []net.IP
+	if ips, err = resolver.LookupIP(ctx, ipNetwork, host); err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(ips[0].String(), port), nil
+}
+
+func (d *Socks5Dialer) handshake(conn net.Conn, address string) error {
+	host, portString, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	var port int
+	if port, err = strconv.Atoi(portString); err != nil || port < 0 || port > 65535 {
+		return fmt.Errorf("socks5: invalid port %s", portString)
+	}
+
+	methods := []byte{socks5AuthNone}
+	if d.Username != "" {
+		methods = append(methods, socks5AuthPassword)
+	}
+	if _, err = conn.Write(append([]byte{socks5Version, byte(len(methods))}, methods...)); err != nil {
+		return err
+	}
+
+	reply := make([]byte, 2)
+	if _, err = io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != socks5Version {
+		return fmt.Errorf("socks5: unexpected version %d: %w", reply[0], ErrProxyHandshake)
+	}
+
+	switch reply[1] {
+	case socks5AuthNone:
+	case socks5AuthPassword:
+		if err = d.authenticate(conn); err != nil {
+			return err
+		}
+	case socks5AuthUnavailable:
+		return fmt.Errorf("socks5: no acceptable authentication method: %w", ErrProxyHandshake)
+	default:
+		return fmt.Errorf("socks5: unsupported authentication method %d: %w", reply[1], ErrProxyHandshake)
+	}
+
+	request := []byte{socks5Version, socks5CommandConnect, 0x00}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			request = append(request, socks5AddressIpv4)
+			request = append(request, ip4...)
+		} else {
+			request = append(request, socks5AddressIpv6)
+			request = append(request, ip.To16()...)
+		}
+	} else {
+		if len(host) > 255 {
+			return fmt.Errorf("socks5: host name too long: %s", host)
+		}
+		request = append(request, socks5AddressDomain, byte(len(host)))
+		request = append(request, host...)
+	}
+	request = binary.BigEndian.AppendUint16(request, uint16(port))
+	if _, err = conn.Write(request); err != nil {
+		return err
+	}
+
+	// Version, reply code, reserved and address type, followed by the bound address which is not used
+	header := make([]byte, 4)
+	if _, err = io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	if header[1] != 0x00 {
+		return fmt.Errorf("socks5: connect to %s failed: %s: %w", address, socks5ReplyText(header[1]), ErrProxyHandshake)
+	}
+
+	var skip int
+	switch header[3] {
+	case socks5AddressIpv4:
+		skip = net.IPv4len
+	case socks5AddressIpv6:
+		skip = net.IPv6len
+	case socks5AddressDomain:
+		length := make([]byte, 1)
+		if _, err = io.ReadFull(conn, length); err != nil {
+			return err
+		}
+		skip = int(length[0])
+	default:
+		return fmt.Errorf("socks5: unexpected address type %d: %w", header[3], ErrProxyHandshake)
+	}
+	_, err = io.ReadFull(conn, make([]byte, skip+2))
+	return err
+}
+
+// authenticate performs the username/password authentication of RFC 1929
+func (d *Socks5Dialer) authenticate(conn net.Conn) error {
+	if len(d.Username) > 255 || len(d.Password) > 255 {
+		return fmt.Errorf("socks5: credentials too long: %w", ErrProxyHandshake)
+	}
+
+	request := []byte{0x01, byte(len(d.Username))}
+	request = append(request, d.Username...)
+	request = append(request, byte(len(d.Password)))
+	request = append(request, d.Password...)
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[1] != 0x00 {
+		return fmt.Errorf("socks5: authentication failed: %w", ErrProxyHandshake)
+	}
+	return nil
+}
+
+func socks5ReplyText(code byte) string {
+	switch code {
+	case 0x01:
+		return "general failure"
+	case 0x02:
+		return "connection not allowed by ruleset"
+	case 0x03:
+		return "network unreachable"
+	case 0x04:
+		return "host unreachable"
+	case 0x05:
+		return "connection refused"
+	case 0x06:
+		return "ttl expired"
+	case 0x07:
+		return "command not supported"
+	case 0x08:
+		return "address type not supported"
+	default:
+		return "unknown error " + strconv.Itoa(int(code))
+	}
+}
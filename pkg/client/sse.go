@@ -0,0 +1,235 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type SseEvent struct {
+	Id    string
+	Event string
+	Data  string
+	Retry time.Duration
+}
+
+func NewSseClient(c *http.Client, url string) *SseClient {
+	return &SseClient{
+		Client:     c,
+		Url:        url,
+		Header:     make(http.Header),
+		RetryDelay: 3 * time.Second,
+	}
+}
+
+type SseClient struct {
+	Client      *http.Client
+	Url         string
+	Header      http.Header
+	RetryDelay  time.Duration
+	MaxRetries  int
+	LastEventId string
+}
+
+// Subscribe connects to the event stream and calls handler for every event received.
+// When the connection drops, the client reconnects and resumes the stream using the Last-Event-ID header.
+// Subscribe returns when ctx is cancelled, the handler returns an error, the server answers with 204 No Content,
+// or when MaxRetries consecutive reconnects have failed.
+func (c *SseClient) Subscribe(ctx context.Context, handler func(e SseEvent) error) error {
+	var (
+		err     error
+		retries int
+	)
+
+	for {
+		var received bool
+		received, err = c.stream(ctx, handler)
+		if received {
+			retries = 0
+		}
+
+		switch {
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case errors.Is(err, errSseStreamEnded):
+			return nil
+		case errors.Is(err, ErrSseUnexpectedStatus), errors.Is(err, ErrSseUnexpectedContentType):
+			return err
+		case errors.As(err, new(sseHandlerError)):
+			return errors.Unwrap(err)
+		}
+
+		retries++
+		if c.MaxRetries > 0 && retries > c.MaxRetries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(c.RetryDelay):
+		}
+	}
+}
+
+func (c *SseClient) stream(ctx context.Context, handler func(e SseEvent) error) (bool, error) {
+	var (
+		err      error
+		req      *http.Request
+		res      *http.Response
+		received bool
+	)
+
+	if req, err = http.NewRequestWithContext(ctx, http.MethodGet, c.Url, nil); err != nil {
+		return false, err
+	}
+	for k, v := range c.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Cache-Control", "no-cache")
+	if c.LastEventId != "" {
+		req.Header.Set("Last-Event-ID", c.LastEventId)
+	}
+
+	if res, err = c.Client.Do(req); err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNoContent {
+		return false, errSseStreamEnded
+	}
+	if res.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("%w: %d", ErrSseUnexpectedStatus, res.StatusCode)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type")); mediaType != "text/event-stream" {
+		return false, fmt.Errorf("%w: %s", ErrSseUnexpectedContentType, mediaType)
+	}
+
+	var (
+		e    SseEvent
+		data strings.Builder
+		seen bool
+	)
+	scanner := bufio.NewScanner(res.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	scanner.Split(newSseLineSplitter())
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// An empty line dispatches the event
+		if line == "" {
+			if seen {
+				e.Data = strings.TrimSuffix(data.String(), "\n")
+				e.Id = c.LastEventId
+				received = true
+				if err = handler(e); err != nil {
+					return received, sseHandlerError{err: err}
+				}
+			}
+			e, seen = SseEvent{}, false
+			data.Reset()
+			continue
+		}
+
+		// Lines starting with a colon are comments
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			e.Event = value
+		case "data":
+			data.WriteString(value + "\n")
+			seen = true
+		case "id":
+			if !strings.Contains(value, "\x00") {
+				c.LastEventId = value
+			}
+		case "retry":
+			if ms, convErr := strconv.ParseInt(value, 10, 64); convErr == nil {
+				e.Retry = time.Duration(ms) * time.Millisecond
+				c.RetryDelay = e.Retry
+			}
+		}
+	}
+
+	if err = scanner.Err(); err != nil {
+		return received, err
+	}
+	return received, io.ErrUnexpectedEOF
+}
+
+// newSseLineSplitter splits the stream on CR LF, LF and a lone CR.
+// A CR is handled as soon as it is read, so an event ending in CR is dispatched without waiting for more data.
+func newSseLineSplitter() bufio.SplitFunc {
+	var skipLf bool
+
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		if skipLf && len(data) > 0 {
+			skipLf = false
+			if data[0] == '\n' {
+				return 1, nil, nil
+			}
+		}
+
+		if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+			if data[i] == '\r' {
+				if i+1 < len(data) {
+					if data[i+1] == '\n' {
+						return i + 2, data[:i], nil
+					}
+				} else {
+					skipLf = true
+				}
+			}
+			return i + 1, data[:i], nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	}
+}
+
+var errSseStreamEnded = errors.New("event stream ended by server")
+
+type sseHandlerError struct {
+	err error
+}
+
+func (e sseHandlerError) Error() string {
+	return e.err.Error()
+}
+
+func (e sseHandlerError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,252 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package client
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/corelayer/go-kit/pkg/pathutils"
+)
+
+// WithCaFile trusts the CA certificates in the PEM bundle at path, in addition to the system roots
+func WithCaFile(path string) HttpClientOption {
+	return func(c *httpClientConfig) error {
+		expandedPath, err := pathutils.GetExpandedPath(path)
+		if err != nil {
+			return err
+		}
+
+		var content []byte
+		if content, err = os.ReadFile(expandedPath); err != nil {
+			return err
+		}
+		if err = appendCaPem(c, content); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		return nil
+	}
+}
+
+// WithCaDirectory trusts the CA certificates in all .pem and .crt files in path, in addition to the system roots
+func WithCaDirectory(path string) HttpClientOption {
+	return func(c *httpClientConfig) error {
+		expandedPath, err := pathutils.GetExpandedPath(path)
+		if err != nil {
+			return err
+		}
+
+		var files []string
+		if files, err = pathutils.GetFilenames(expandedPath, []string{".pem", ".crt"}); err != nil {
+			return err
+		}
+
+		for _, file := range files {
+			var content []byte
+			if content, err = os.ReadFile(file); err != nil {
+				return err
+			}
+			if err = appendCaPem(c, content); err != nil {
+				return fmt.Errorf("%s: %w", file, err)
+			}
+		}
+		return nil
+	}
+}
+
+// WithCaPem trusts the CA certificates in the PEM data, in addition to the system roots
+func WithCaPem(content []byte) HttpClientOption {
+	return func(c *httpClientConfig) error {
+		return appendCaPem(c, content)
+	}
+}
+
+// WithClientCertificate presents the certificate to servers requesting one.
+// The files are checked for changes on every handshake, so rotated certificates are picked up without restarting.
+func WithClientCertificate(certFile string, keyFile string) HttpClientOption {
+	return func(c *httpClientConfig) error {
+		var (
+			err              error
+			expandedCertFile string
+			expandedKeyFile  string
+		)
+		if expandedCertFile, err = pathutils.GetExpandedPath(certFile); err != nil {
+			return err
+		}
+		if expandedKeyFile, err = pathutils.GetExpandedPath(keyFile); err != nil {
+			return err
+		}
+
+		r := &clientCertificateReloader{
+			certFile: expandedCertFile,
+			keyFile:  expandedKeyFile,
+		}
+		if err = r.load(); err != nil {
+			return err
+		}
+		c.transport.TLSClientConfig.GetClientCertificate = r.GetClientCertificate
+		return nil
+	}
+}
+
+// WithMinTlsVersion sets the minimum TLS version, e.g. tls.VersionTLS13
+func WithMinTlsVersion(version uint16) HttpClientOption {
+	return func(c *httpClientConfig) error {
+		c.transport.TLSClientConfig.MinVersion = version
+		return nil
+	}
+}
+
+// WithServerName overrides the server name used for SNI and certificate verification for all hosts
+func WithServerName(name string) HttpClientOption {
+	return func(c *httpClientConfig) error {
+		c.transport.TLSClientConfig.ServerName = name
+		return nil
+	}
+}
+
+// WithInsecureSkipVerify disables certificate verification when insecure is true, pinned keys are then only
+// matched against the leaf certificate. This makes the connection vulnerable to interception and should only be used for testing.
+func WithInsecureSkipVerify(insecure bool) HttpClientOption {
+	return func(c *httpClientConfig) error {
+		if insecure {
+			slog.Warn("tls certificate verification is disabled")
+		}
+		c.transport.TLSClientConfig.InsecureSkipVerify = insecure
+		return nil
+	}
+}
+
+// WithSpkiPins only accepts connections where a certificate in a verified chain has one of the pinned public keys.
+// Pins are base64 encoded SHA-256 hashes of the DER encoded SubjectPublicKeyInfo, optionally prefixed with "sha256/".
+// Without certificate verification there is no verified chain, only the leaf certificate is matched against the pins.
+func WithSpkiPins(pins ...string) HttpClientOption {
+	return func(c *httpClientConfig) error {
+		pinned := make(map[string]struct{}, len(pins))
+		for _, pin := range pins {
+			pin = strings.TrimPrefix(pin, "sha256/")
+			if decoded, err := base64.StdEncoding.DecodeString(pin); err != nil || len(decoded) != sha256.Size {
+				return fmt.Errorf("%w: %q", ErrSpkiPinInvalid, pin)
+			}
+			pinned[pin] = struct{}{}
+		}
+
+		c.transport.TLSClientConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+			// Certificates sent by the server which are not part of a verified chain prove nothing
+			for _, chain := range cs.VerifiedChains {
+				for _, cert := range chain {
+					if _, ok := pinned[SpkiHash(cert)]; ok {
+						return nil
+					}
+				}
+			}
+			if len(cs.VerifiedChains) == 0 && len(cs.PeerCertificates) > 0 {
+				if _, ok := pinned[SpkiHash(cs.PeerCertificates[0])]; ok {
+					return nil
+				}
+			}
+			return ErrCertificatePinMismatch
+		}
+		return nil
+	}
+}
+
+// SpkiHash returns the base64 encoded SHA-256 hash of the public key of cert, as used by WithSpkiPins
+func SpkiHash(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func appendCaPem(c *httpClientConfig, content []byte) error {
+	config := c.transport.TLSClientConfig
+	if config.RootCAs == nil {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		config.RootCAs = pool
+	}
+	if !config.RootCAs.AppendCertsFromPEM(content) {
+		return ErrNoCertificates
+	}
+	return nil
+}
+
+type clientCertificateReloader struct {
+	certFile string
+	keyFile  string
+	cert     *tls.Certificate
+	modTime  time.Time
+	mux      sync.Mutex
+}
+
+func (r *clientCertificateReloader) GetClientCertificate(_ *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if modTime, err := r.latestModTime(); err == nil && modTime.After(r.modTime) {
+		if err = r.loadLocked(); err != nil {
+			slog.Error("could not reload client certificate, using previous certificate", "certificate", r.certFile, "error", err)
+		} else {
+			slog.Info("reloaded client certificate", "certificate", r.certFile)
+		}
+	}
+	return r.cert, nil
+}
+
+func (r *clientCertificateReloader) load() error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return r.loadLocked()
+}
+
+func (r *clientCertificateReloader) loadLocked() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+
+	var cert tls.Certificate
+	if cert, err = tls.LoadX509KeyPair(r.certFile, r.keyFile); err != nil {
+		return err
+	}
+	r.cert = &cert
+	r.modTime = modTime
+	return nil
+}
+
+func (r *clientCertificateReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
@@ -0,0 +1,147 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+package client
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWithSpkiPins(t *testing.T) {
+	root, rootKey := testCertificate(t, "root", true, nil, nil)
+	leaf, leafKey := testCertificate(t, "leaf", false, root, rootKey)
+	unrelated, _ := testCertificate(t, "unrelated", true, nil, nil)
+
+	// The server sends a certificate which is not part of the verified chain after its leaf
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{{
+			Certificate: [][]byte{leaf.Raw, unrelated.Raw},
+			PrivateKey:  leafKey,
+		}},
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	caPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw})
+
+	tests := []struct {
+		name     string
+		pin      string
+		insecure bool
+		err      error
+	}{
+		{
+			name: "leaf pin",
+			pin:  SpkiHash(leaf),
+		},
+		{
+			name: "root pin",
+			pin:  "sha256/" + SpkiHash(root),
+		},
+		{
+			name: "pin of certificate outside the verified chain",
+			pin:  SpkiHash(unrelated),
+			err:  ErrCertificatePinMismatch,
+		},
+		{
+			name:     "leaf pin without verification",
+			pin:      SpkiHash(leaf),
+			insecure: true,
+		},
+		{
+			name:     "pin of certificate after the leaf without verification",
+			pin:      SpkiHash(unrelated),
+			insecure: true,
+			err:      ErrCertificatePinMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewHttpClientWithOptions("test", WithCaPem(caPem), WithInsecureSkipVerify(tt.insecure), WithSpkiPins(tt.pin))
+			if err != nil {
+				t.Fatalf("NewHttpClientWithOptions() error = %v", err)
+			}
+
+			var res *http.Response
+			res, err = c.Get(server.URL)
+			if err == nil {
+				_ = res.Body.Close()
+			}
+			if tt.err == nil && err != nil {
+				t.Errorf("Get() error = %v", err)
+			}
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("Get() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestWithSpkiPins_Invalid(t *testing.T) {
+	for _, pin := range []string{"", "not base64", "sha256/AAAA"} {
+		if _, err := NewHttpClientWithOptions("test", WithSpkiPins(pin)); !errors.Is(err, ErrSpkiPinInvalid) {
+			t.Errorf("WithSpkiPins(%q) error = %v, want %v", pin, err, ErrSpkiPinInvalid)
+		}
+	}
+}
+
+// testCertificate creates a certificate for 127.0.0.1, which is self-signed when parent is nil
+func testCertificate(t *testing.T, name string, ca bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  ca,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	var der []byte
+	if der, err = x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey); err != nil {
+		t.Fatal(err)
+	}
+	var cert *x509.Certificate
+	if cert, err = x509.ParseCertificate(der); err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
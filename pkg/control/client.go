@@ -0,0 +1,84 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package control
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"strconv"
+	"sync/atomic"
+)
+
+func NewClient(path string) *Client {
+	return &Client{
+		path: path,
+	}
+}
+
+type Client struct {
+	path string
+	id   atomic.Int64
+}
+
+// Call invokes method on the control server and decodes the result into result, which may be nil
+func (c *Client) Call(ctx context.Context, method string, params any, result any) error {
+	var (
+		err  error
+		conn net.Conn
+		raw  json.RawMessage
+	)
+
+	if params != nil {
+		if raw, err = json.Marshal(params); err != nil {
+			return err
+		}
+	}
+
+	var d net.Dialer
+	if conn, err = d.DialContext(ctx, "unix", c.path); err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	req := request{
+		JsonRpc: "2.0",
+		Id:      json.RawMessage(strconv.FormatInt(c.id.Add(1), 10)),
+		Method:  method,
+		Params:  raw,
+	}
+	if err = json.NewEncoder(conn).Encode(req); err != nil {
+		return err
+	}
+
+	var res response
+	if err = json.NewDecoder(bufio.NewReader(conn)).Decode(&res); err != nil {
+		return err
+	}
+	if res.Error != nil {
+		return res.Error
+	}
+	if result == nil || res.Result == nil {
+		return nil
+	}
+	return json.Unmarshal(res.Result, result)
+}
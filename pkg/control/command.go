@@ -0,0 +1,125 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/corelayer/go-kit/pkg/application"
+)
+
+// NewCommand returns a "ctl" command with subcommands calling the built-in methods of the control server at socketPath
+func NewCommand(socketPath string) application.Command {
+	flags := &commandFlags{}
+
+	return application.Command{
+		Root: &cobra.Command{
+			Use:   "ctl",
+			Short: "Control a running instance",
+		},
+		Configure: func(cmd *cobra.Command) {
+			cmd.PersistentFlags().StringVar(&flags.socket, "socket", socketPath, "path to the control socket")
+			cmd.PersistentFlags().DurationVar(&flags.timeout, "timeout", 10*time.Second, "timeout for control requests")
+		},
+		SubCommands: []application.Commander{
+			application.Command{
+				Root: &cobra.Command{
+					Use:   "status",
+					Short: "Show the status of the running instance",
+					Args:  cobra.NoArgs,
+					RunE: func(cmd *cobra.Command, args []string) error {
+						return flags.call(cmd, "status", nil)
+					},
+				},
+			},
+			application.Command{
+				Root: &cobra.Command{
+					Use:   "reload-config",
+					Short: "Reload the configuration files",
+					Args:  cobra.NoArgs,
+					RunE: func(cmd *cobra.Command, args []string) error {
+						return flags.call(cmd, "reload-config", nil)
+					},
+				},
+			},
+			application.Command{
+				Root: &cobra.Command{
+					Use:       "set-log-level <level>",
+					Short:     "Change the log level",
+					Args:      cobra.ExactArgs(1),
+					ValidArgs: []string{"error", "warn", "info", "debug"},
+					RunE: func(cmd *cobra.Command, args []string) error {
+						return flags.call(cmd, "set-log-level", LogLevelParams{Level: args[0]})
+					},
+				},
+			},
+			application.Command{
+				Root: &cobra.Command{
+					Use:       "maintenance [on|off]",
+					Short:     "Show or toggle maintenance mode",
+					Args:      cobra.MatchAll(cobra.MaximumNArgs(1), cobra.OnlyValidArgs),
+					ValidArgs: []string{"on", "off"},
+					RunE: func(cmd *cobra.Command, args []string) error {
+						var p MaintenanceParams
+						if len(args) == 1 {
+							enabled := args[0] == "on"
+							p.Enabled = &enabled
+						}
+						return flags.call(cmd, "maintenance", p)
+					},
+				},
+			},
+			application.Command{
+				Root: &cobra.Command{
+					Use:   "shutdown",
+					Short: "Gracefully shut down the running instance",
+					Args:  cobra.NoArgs,
+					RunE: func(cmd *cobra.Command, args []string) error {
+						return flags.call(cmd, "shutdown", nil)
+					},
+				},
+			},
+		},
+	}
+}
+
+type commandFlags struct {
+	socket  string
+	timeout time.Duration
+}
+
+func (f *commandFlags) call(cmd *cobra.Command, method string, params any) error {
+	ctx, cancel := context.WithTimeout(cmd.Context(), f.timeout)
+	defer cancel()
+
+	var result json.RawMessage
+	if err := NewClient(f.socket).Call(ctx, method, params, &result); err != nil {
+		return err
+	}
+
+	output, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(cmd.OutOrStdout(), string(output))
+	return err
+}
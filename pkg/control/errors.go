@@ -0,0 +1,64 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package control
+
+import "fmt"
+
+const (
+	ErrInvalidLogLevelMessage = "invalid log level"
+	ErrNotAvailableMessage    = "method not available"
+)
+
+var (
+	ErrInvalidLogLevel = InvalidLogLevelError{message: ErrInvalidLogLevelMessage}
+	ErrNotAvailable    = NotAvailableError{message: ErrNotAvailableMessage}
+)
+
+// JSON-RPC 2.0 error codes
+const (
+	ParseErrorCode     = -32700
+	InvalidRequestCode = -32600
+	MethodNotFoundCode = -32601
+	InvalidParamsCode  = -32602
+	InternalErrorCode  = -32603
+)
+
+// Error is returned by the control server when a method fails
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("control error %d: %s", e.Code, e.Message)
+}
+
+type InvalidLogLevelError struct {
+	message string
+}
+
+func (e InvalidLogLevelError) Error() string {
+	return e.message
+}
+
+type NotAvailableError struct {
+	message string
+}
+
+func (e NotAvailableError) Error() string {
+	return e.message
+}
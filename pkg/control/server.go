@@ -0,0 +1,317 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package control
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/corelayer/go-kit/pkg/application"
+)
+
+type HandlerFunc func(ctx context.Context, params json.RawMessage) (any, error)
+
+// Builtins configures the built-in methods, methods for which no function is set report ErrNotAvailable
+type Builtins struct {
+	Status   func() any
+	Reload   func() error
+	LogLevel *slog.LevelVar
+	Shutdown func()
+	// Maintenance is toggled by the maintenance method, e.g. a *server.Maintenance
+	Maintenance Maintenance
+}
+
+type Maintenance interface {
+	Enable()
+	Disable()
+	Enabled() bool
+}
+
+// NewServer creates a control server listening on the unix socket at path
+func NewServer(path string) *Server {
+	return &Server{
+		path:     path,
+		handlers: make(map[string]HandlerFunc),
+		conns:    make(map[net.Conn]struct{}),
+	}
+}
+
+type Server struct {
+	path     string
+	handlers map[string]HandlerFunc
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closed   bool
+	wg       sync.WaitGroup
+	mux      sync.Mutex
+}
+
+func (s *Server) Handle(method string, h HandlerFunc) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.handlers[method] = h
+}
+
+// RegisterBuiltins registers the status, reload-config, set-log-level, maintenance and shutdown methods
+func (s *Server) RegisterBuiltins(b Builtins) {
+	s.Handle("status", func(_ context.Context, _ json.RawMessage) (any, error) {
+		if b.Status == nil {
+			return map[string]any{"pid": os.Getpid()}, nil
+		}
+		return b.Status(), nil
+	})
+	s.Handle("reload-config", func(_ context.Context, _ json.RawMessage) (any, error) {
+		reload := b.Reload
+		if reload == nil {
+			if application.Config == nil {
+				return nil, ErrNotAvailable
+			}
+			reload = application.Config.Reload
+		}
+		if err := reload(); err != nil {
+			return nil, err
+		}
+		return "ok", nil
+	})
+	s.Handle("set-log-level", func(_ context.Context, params json.RawMessage) (any, error) {
+		if b.LogLevel == nil {
+			return nil, ErrNotAvailable
+		}
+		var p LogLevelParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, &Error{Code: InvalidParamsCode, Message: err.Error()}
+		}
+		level, ok := application.ParseLogLevel(p.Level)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidLogLevel, p.Level)
+		}
+		b.LogLevel.Set(level)
+		slog.Info("log level changed", "level", level.String())
+		return level.String(), nil
+	})
+	s.Handle("maintenance", func(_ context.Context, params json.RawMessage) (any, error) {
+		if b.Maintenance == nil {
+			return nil, ErrNotAvailable
+		}
+		var p MaintenanceParams
+		if len(params) > 0 {
+			if err := json.Unmarshal(params, &p); err != nil {
+				return nil, &Error{Code: InvalidParamsCode, Message: err.Error()}
+			}
+		}
+		if p.Enabled != nil {
+			if *p.Enabled {
+				b.Maintenance.Enable()
+			} else {
+				b.Maintenance.Disable()
+			}
+		}
+		enabled := b.Maintenance.Enabled()
+		return MaintenanceParams{Enabled: &enabled}, nil
+	})
+	s.Handle("shutdown", func(_ context.Context, _ json.RawMessage) (any, error) {
+		if b.Shutdown == nil {
+			return nil, ErrNotAvailable
+		}
+		// Respond before the shutdown closes the control socket
+		go b.Shutdown()
+		return "shutting down", nil
+	})
+}
+
+// Serve accepts connections until ctx is cancelled or Close is called
+func (s *Server) Serve(ctx context.Context) error {
+	var (
+		err      error
+		listener net.Listener
+	)
+
+	// Remove a stale socket left behind by a previous process
+	if _, err = os.Stat(s.path); err == nil {
+		if conn, dialErr := net.Dial("unix", s.path); dialErr == nil {
+			_ = conn.Close()
+			return os.ErrExist
+		}
+		_ = os.Remove(s.path)
+	}
+
+	if listener, err = listenPrivate(s.path); err != nil {
+		return err
+	}
+
+	s.mux.Lock()
+	if s.closed {
+		s.mux.Unlock()
+		_ = listener.Close()
+		_ = os.Remove(s.path)
+		return nil
+	}
+	s.listener = listener
+	s.mux.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		_ = s.Close()
+	}()
+
+	for {
+		var conn net.Conn
+		if conn, err = listener.Accept(); err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				s.wg.Wait()
+				return nil
+			}
+			return err
+		}
+
+		// A connection accepted while Close runs is not in conns yet and has to be closed here
+		s.mux.Lock()
+		if s.closed {
+			s.mux.Unlock()
+			_ = conn.Close()
+			continue
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mux.Unlock()
+
+		go s.serveConn(ctx, conn)
+	}
+}
+
+func (s *Server) Close() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	if s.listener == nil {
+		return nil
+	}
+	err := s.listener.Close()
+	_ = os.Remove(s.path)
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	return err
+}
+
+// listenPrivate binds the socket in a directory only accessible by the current user and moves it to path afterwards,
+// so it is never reachable with the permissions of the umask
+func listenPrivate(path string) (net.Listener, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".control-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "socket")
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: socket, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	// The socket is removed from path by Close, the listener would only try to remove the temporary name
+	listener.SetUnlinkOnClose(false)
+
+	if err = os.Chmod(socket, 0600); err == nil {
+		err = os.Rename(socket, path)
+	}
+	if err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+func (s *Server) serveConn(ctx context.Context, conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mux.Lock()
+		delete(s.conns, conn)
+		s.mux.Unlock()
+		_ = conn.Close()
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	encoder := json.NewEncoder(conn)
+
+	for scanner.Scan() {
+		res := s.handle(ctx, scanner.Bytes())
+		if res == nil {
+			continue
+		}
+		if err := encoder.Encode(res); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) handle(ctx context.Context, data []byte) *response {
+	var req request
+	if err := json.Unmarshal(data, &req); err != nil {
+		return &response{JsonRpc: "2.0", Id: json.RawMessage("null"), Error: &Error{Code: ParseErrorCode, Message: err.Error()}}
+	}
+
+	res := &response{JsonRpc: "2.0", Id: req.Id}
+	if req.Id == nil {
+		res.Id = json.RawMessage("null")
+	}
+	if req.JsonRpc != "2.0" || req.Method == "" {
+		res.Error = &Error{Code: InvalidRequestCode, Message: "invalid request"}
+		return res
+	}
+
+	s.mux.Lock()
+	h, found := s.handlers[req.Method]
+	s.mux.Unlock()
+	if !found {
+		res.Error = &Error{Code: MethodNotFoundCode, Message: "method not found: " + req.Method}
+		return res
+	}
+
+	result, err := h(ctx, req.Params)
+	if err != nil {
+		var rpcErr *Error
+		switch {
+		case errors.As(err, &rpcErr):
+			res.Error = rpcErr
+		case errors.Is(err, ErrInvalidLogLevel):
+			res.Error = &Error{Code: InvalidParamsCode, Message: err.Error()}
+		default:
+			res.Error = &Error{Code: InternalErrorCode, Message: err.Error()}
+		}
+	} else if res.Result, err = json.Marshal(result); err != nil {
+		res.Error = &Error{Code: InternalErrorCode, Message: err.Error()}
+	}
+
+	// Notifications do not receive a response
+	if req.Id == nil {
+		return nil
+	}
+	return res
+}
@@ -0,0 +1,177 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package filestore
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/corelayer/go-kit/pkg/pathutils"
+)
+
+// New creates a store persisting every value as a JSON file named after its hex encoded id in path.
+// Missing files and ids which are not hex encoded are reported as notFound.
+func New[T any](path string, extension string, notFound error) (*Store[T], error) {
+	var (
+		err          error
+		expandedPath string
+	)
+
+	if expandedPath, err = pathutils.GetExpandedPath(path); err != nil {
+		return nil, err
+	}
+	if err = pathutils.CreateDirectory(expandedPath, 0700); err != nil {
+		return nil, err
+	}
+	return &Store[T]{
+		path:      expandedPath,
+		extension: extension,
+		notFound:  notFound,
+	}, nil
+}
+
+type Store[T any] struct {
+	path      string
+	extension string
+	notFound  error
+	mux       sync.Mutex
+}
+
+// Save writes to a temporary file first, so readers never see a partially written value
+func (s *Store[T]) Save(id string, v T) error {
+	var (
+		err     error
+		file    string
+		content []byte
+	)
+
+	if file, err = s.filename(id); err != nil {
+		return err
+	}
+	if content, err = json.Marshal(v); err != nil {
+		return err
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	tmp := file + ".tmp"
+	if err = os.WriteFile(tmp, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+func (s *Store[T]) Load(id string) (T, error) {
+	file, err := s.filename(id)
+	if err != nil {
+		var v T
+		return v, err
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.read(file)
+}
+
+// List returns all values in the store, a file which cannot be read is logged and skipped so it does not hide the others
+func (s *Store[T]) List() ([]T, error) {
+	files, err := pathutils.GetFilenames(s.path, []string{s.extension})
+	if err != nil {
+		return nil, err
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	output := make([]T, 0, len(files))
+	for _, file := range files {
+		var v T
+		if v, err = s.read(file); err != nil {
+			slog.Warn("skipping unreadable file", "file", file, "error", err)
+			continue
+		}
+		output = append(output, v)
+	}
+	return output, nil
+}
+
+func (s *Store[T]) Delete(id string) error {
+	file, err := s.filename(id)
+	if err != nil {
+		return err
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if err = os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// DeleteFunc removes all values for which remove returns true, files which cannot be decoded are removed as well
+func (s *Store[T]) DeleteFunc(remove func(v T) bool) error {
+	files, err := pathutils.GetFilenames(s.path, []string{s.extension})
+	if err != nil {
+		return err
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	for _, file := range files {
+		var (
+			content []byte
+			v       T
+		)
+		if content, err = os.ReadFile(file); err != nil {
+			continue
+		}
+		if err = json.Unmarshal(content, &v); err != nil || remove(v) {
+			_ = os.Remove(file)
+		}
+	}
+	return nil
+}
+
+func (s *Store[T]) filename(id string) (string, error) {
+	// Ids are hex encoded, anything else could be used to escape the store directory
+	if _, err := hex.DecodeString(id); err != nil || id == "" {
+		return "", s.notFound
+	}
+	return filepath.Join(s.path, id+s.extension), nil
+}
+
+func (s *Store[T]) read(file string) (T, error) {
+	var v T
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return v, s.notFound
+		}
+		return v, err
+	}
+	return v, json.Unmarshal(content, &v)
+}
@@ -0,0 +1,33 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package ioutils
+
+import (
+	"bytes"
+	"io"
+)
+
+// PeekBody reads up to limit bytes from body, the returned body still yields the complete content including the prefix
+func PeekBody(body io.ReadCloser, limit int64) ([]byte, io.ReadCloser, error) {
+	prefix, err := io.ReadAll(io.LimitReader(body, limit))
+	return prefix, readCloser{Reader: io.MultiReader(bytes.NewReader(prefix), body), Closer: body}, err
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,72 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+package redact
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Placeholder replaces redacted values
+const Placeholder = "[REDACTED]"
+
+// Fields is a set of field names which are matched case-insensitively
+type Fields map[string]struct{}
+
+func NewFields(names ...string) Fields {
+	f := make(Fields, len(names))
+	for _, name := range names {
+		f[strings.ToLower(name)] = struct{}{}
+	}
+	return f
+}
+
+func (f Fields) Contains(name string) bool {
+	_, found := f[strings.ToLower(name)]
+	return found
+}
+
+// Json replaces the values of object keys in fields at any depth of a decoded JSON document, v is modified in place
+func Json(v any, fields Fields) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, value := range t {
+			if fields.Contains(k) {
+				t[k] = Placeholder
+				continue
+			}
+			t[k] = Json(value, fields)
+		}
+	case []any:
+		for i, value := range t {
+			t[i] = Json(value, fields)
+		}
+	}
+	return v
+}
+
+// Values returns a copy of query or form values with the values of keys in fields replaced
+func Values(values url.Values, fields Fields) url.Values {
+	output := make(url.Values, len(values))
+	for k, v := range values {
+		if fields.Contains(k) {
+			output[k] = []string{Placeholder}
+			continue
+		}
+		output[k] = v
+	}
+	return output
+}
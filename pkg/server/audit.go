@@ -0,0 +1,126 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/corelayer/go-kit/pkg/audit"
+	"github.com/corelayer/go-kit/pkg/internal/ioutils"
+	"github.com/corelayer/go-kit/pkg/redact"
+)
+
+type AuditOptions struct {
+	// Principal returns the authenticated identity of the request, requests without principal are recorded as anonymous
+	Principal func(r *http.Request) string
+	// Methods are the recorded request methods, nil records the methods of DefaultAuditOptions
+	Methods []string
+	// RedactFields are JSON object keys, matched case-insensitively at any depth, whose values are replaced in the recorded body
+	RedactFields []string
+	// MaxBodySize limits the recorded request body, larger and non-JSON bodies are not recorded
+	MaxBodySize int64
+}
+
+func DefaultAuditOptions() AuditOptions {
+	return AuditOptions{
+		Methods:      []string{http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete},
+		RedactFields: []string{"password", "secret", "token", "apiKey", "authorization"},
+		MaxBodySize:  64 * 1024,
+	}
+}
+
+// AuditRequests records every request with one of the configured methods to w, after the handler has completed
+func AuditRequests(w *audit.Writer, o AuditOptions) Middleware {
+	if o.Methods == nil {
+		o.Methods = DefaultAuditOptions().Methods
+	}
+	fields := redact.NewFields(o.RedactFields...)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if !slices.Contains(o.Methods, r.Method) {
+				next.ServeHTTP(rw, r)
+				return
+			}
+
+			start := time.Now()
+			record := audit.Record{
+				Time:       start,
+				Principal:  "anonymous",
+				Method:     r.Method,
+				Route:      routeOf(next, r),
+				Path:       r.URL.Path,
+				RemoteAddr: r.RemoteAddr,
+			}
+			if o.Principal != nil {
+				if p := o.Principal(r); p != "" {
+					record.Principal = p
+				}
+			}
+			record.Body = auditBody(r, o.MaxBodySize, fields)
+
+			recorder := newResponseRecorder(rw, false)
+			next.ServeHTTP(recorder, r)
+
+			record.Status = recorder.Status()
+			record.Latency = time.Since(start)
+			switch {
+			case record.Status == http.StatusUnauthorized || record.Status == http.StatusForbidden:
+				record.Outcome = audit.OutcomeDenied
+			case record.Status >= http.StatusBadRequest:
+				record.Outcome = audit.OutcomeFailure
+			default:
+				record.Outcome = audit.OutcomeSuccess
+			}
+
+			if err := w.Write(record); err != nil {
+				slog.Error("could not write audit record", "method", record.Method, "route", record.Route, "principal", record.Principal, "error", err)
+			}
+		})
+	}
+}
+
+// auditBody returns the redacted JSON request body, the body remains readable by the handler
+func auditBody(r *http.Request, limit int64, fields redact.Fields) json.RawMessage {
+	if r.Body == nil || r.Body == http.NoBody || limit <= 0 {
+		return nil
+	}
+
+	content, body, err := ioutils.PeekBody(r.Body, limit+1)
+	r.Body = body
+	if err != nil || int64(len(content)) > limit {
+		return nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	var v any
+	if err = decoder.Decode(&v); err != nil {
+		return nil
+	}
+
+	var output []byte
+	if output, err = json.Marshal(redact.Json(v, fields)); err != nil {
+		return nil
+	}
+	return output
+}
@@ -0,0 +1,134 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/corelayer/go-kit/pkg/pathutils"
+)
+
+// NewCertificateStore loads all key pairs found in path.
+// Certificates are read from .crt, .cer and .pem files, the private key is expected in a .key file with the same name.
+// The key pair named defaultName, e.g. "default" for default.crt, is used when no certificate matches the requested server name.
+func NewCertificateStore(path string, defaultName string) (*CertificateStore, error) {
+	c := &CertificateStore{
+		path:        path,
+		defaultName: defaultName,
+	}
+	return c, c.Load()
+}
+
+type CertificateStore struct {
+	path        string
+	defaultName string
+
+	certificates map[string]*tls.Certificate
+	wildcards    map[string]*tls.Certificate
+	fallback     *tls.Certificate
+	mux          sync.RWMutex
+}
+
+// Load reads all key pairs from disk and replaces the certificates currently in use
+func (c *CertificateStore) Load() error {
+	var (
+		err   error
+		files []string
+	)
+
+	if files, err = pathutils.GetFilenames(c.path, []string{".crt", ".cer", ".pem"}); err != nil {
+		return err
+	}
+
+	certificates := make(map[string]*tls.Certificate)
+	wildcards := make(map[string]*tls.Certificate)
+	var fallback *tls.Certificate
+
+	for _, certFile := range files {
+		name := strings.TrimSuffix(certFile, filepath.Ext(certFile))
+		keyFile := name + ".key"
+		if _, err = os.Stat(keyFile); err != nil {
+			continue
+		}
+
+		var cert tls.Certificate
+		if cert, err = tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+			return fmt.Errorf("could not load key pair %s: %w", certFile, err)
+		}
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return fmt.Errorf("could not parse certificate %s: %w", certFile, err)
+		}
+
+		names := cert.Leaf.DNSNames
+		if len(names) == 0 && cert.Leaf.Subject.CommonName != "" {
+			names = []string{cert.Leaf.Subject.CommonName}
+		}
+		for _, n := range names {
+			n = strings.ToLower(n)
+			if suffix, found := strings.CutPrefix(n, "*."); found {
+				wildcards[suffix] = &cert
+			} else {
+				certificates[n] = &cert
+			}
+		}
+
+		if filepath.Base(name) == c.defaultName {
+			fallback = &cert
+		}
+		slog.Debug("loaded certificate", "file", certFile, "names", names)
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.certificates = certificates
+	c.wildcards = wildcards
+	c.fallback = fallback
+	return nil
+}
+
+func (c *CertificateStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+
+	name := strings.TrimSuffix(strings.ToLower(hello.ServerName), ".")
+	if cert, found := c.certificates[name]; found {
+		return cert, nil
+	}
+	if _, suffix, found := strings.Cut(name, "."); found {
+		if cert, found := c.wildcards[suffix]; found {
+			return cert, nil
+		}
+	}
+	if c.fallback != nil {
+		return c.fallback, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrCertificateNotFound, hello.ServerName)
+}
+
+func (c *CertificateStore) TlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: c.GetCertificate,
+	}
+}
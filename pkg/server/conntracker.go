@@ -0,0 +1,120 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package server
+
+import (
+	"net"
+	"net/http"
+	"sync"
+)
+
+func NewConnTracker() *ConnTracker {
+	return &ConnTracker{
+		conns:    make(map[net.Conn]http.ConnState),
+		requests: make(map[string]int),
+	}
+}
+
+// ConnTracker keeps track of open connections through http.Server.ConnState and of in-flight requests through Middleware
+type ConnTracker struct {
+	conns    map[net.Conn]http.ConnState
+	requests map[string]int
+	mux      sync.Mutex
+}
+
+func (t *ConnTracker) ConnState(c net.Conn, state http.ConnState) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	switch state {
+	case http.StateHijacked, http.StateClosed:
+		delete(t.conns, c)
+	default:
+		t.conns[c] = state
+	}
+}
+
+func (t *ConnTracker) Middleware(next http.Handler) http.Handler {
+	if next == nil {
+		next = http.DefaultServeMux
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeOf(next, r)
+
+		t.mux.Lock()
+		t.requests[route]++
+		t.mux.Unlock()
+
+		defer func() {
+			t.mux.Lock()
+			if t.requests[route]--; t.requests[route] <= 0 {
+				delete(t.requests, route)
+			}
+			t.mux.Unlock()
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Connections returns the number of tracked connections per connection state
+func (t *ConnTracker) Connections() map[string]int {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	output := make(map[string]int)
+	for _, state := range t.conns {
+		output[state.String()]++
+	}
+	return output
+}
+
+func (t *ConnTracker) ActiveConnections() int {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	var count int
+	for _, state := range t.conns {
+		if state == http.StateActive {
+			count++
+		}
+	}
+	return count
+}
+
+// InFlight returns the number of requests being handled per route
+func (t *ConnTracker) InFlight() map[string]int {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	output := make(map[string]int, len(t.requests))
+	for route, count := range t.requests {
+		output[route] = count
+	}
+	return output
+}
+
+func (t *ConnTracker) InFlightTotal() int {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	var count int
+	for _, c := range t.requests {
+		count += c
+	}
+	return count
+}
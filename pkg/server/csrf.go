@@ -0,0 +1,163 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"strings"
+)
+
+type CsrfOptions struct {
+	CookieName string
+	HeaderName string
+	FieldName  string
+	Path       string
+	Domain     string
+	Secure     bool
+	SameSite   http.SameSite
+	// ErrorHandler is called when validation fails, a 403 Forbidden response is returned when nil
+	ErrorHandler http.Handler
+}
+
+func DefaultCsrfOptions() CsrfOptions {
+	return CsrfOptions{
+		CookieName: "csrf_token",
+		HeaderName: "X-CSRF-Token",
+		FieldName:  "csrf_token",
+		Path:       "/",
+		Secure:     true,
+		SameSite:   http.SameSiteLaxMode,
+	}
+}
+
+// NewCsrfProtection creates a double-submit cookie CSRF protection.
+// Tokens are signed with key, so a cookie planted by a sibling domain cannot be used to forge a valid token.
+func NewCsrfProtection(key []byte, o CsrfOptions) *CsrfProtection {
+	return &CsrfProtection{
+		key:     key,
+		options: o,
+	}
+}
+
+type CsrfProtection struct {
+	key     []byte
+	options CsrfOptions
+}
+
+type csrfContextKey struct{}
+
+// CsrfToken returns the token to be submitted in forms or request headers by the client
+func CsrfToken(ctx context.Context) string {
+	token, _ := ctx.Value(csrfContextKey{}).(string)
+	return token
+}
+
+func (p *CsrfProtection) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var token string
+		if cookie, err := r.Cookie(p.options.CookieName); err == nil && p.valid(cookie.Value) {
+			token = cookie.Value
+		}
+
+		if !isSafeMethod(r.Method) {
+			if token == "" || !p.matches(token, p.submittedToken(r)) {
+				p.fail(w, r)
+				return
+			}
+		}
+
+		if token == "" {
+			token = p.newToken()
+			http.SetCookie(w, &http.Cookie{
+				Name:     p.options.CookieName,
+				Value:    token,
+				Path:     p.options.Path,
+				Domain:   p.options.Domain,
+				Secure:   p.options.Secure,
+				HttpOnly: true,
+				SameSite: p.options.SameSite,
+			})
+		}
+
+		w.Header().Add("Vary", "Cookie")
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), csrfContextKey{}, token)))
+	})
+}
+
+func (p *CsrfProtection) submittedToken(r *http.Request) string {
+	if token := r.Header.Get(p.options.HeaderName); token != "" {
+		return token
+	}
+	if p.options.FieldName != "" {
+		return r.PostFormValue(p.options.FieldName)
+	}
+	return ""
+}
+
+func (p *CsrfProtection) matches(expected string, submitted string) bool {
+	return submitted != "" && subtle.ConstantTimeCompare([]byte(expected), []byte(submitted)) == 1
+}
+
+func (p *CsrfProtection) fail(w http.ResponseWriter, r *http.Request) {
+	if p.options.ErrorHandler != nil {
+		p.options.ErrorHandler.ServeHTTP(w, r)
+		return
+	}
+	http.Error(w, ErrCsrfTokenInvalidMessage, http.StatusForbidden)
+}
+
+func (p *CsrfProtection) newToken() string {
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		panic(err)
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(nonce)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(p.sign(encoded))
+}
+
+func (p *CsrfProtection) valid(token string) bool {
+	nonce, signature, found := strings.Cut(token, ".")
+	if !found {
+		return false
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(mac, p.sign(nonce))
+}
+
+func (p *CsrfProtection) sign(nonce string) []byte {
+	h := hmac.New(sha256.New, p.key)
+	h.Write([]byte(nonce))
+	return h.Sum(nil)
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCsrfProtection_Middleware(t *testing.T) {
+	p := NewCsrfProtection(bytes.Repeat([]byte{1}, 32), DefaultCsrfOptions())
+	token := p.newToken()
+	forged := NewCsrfProtection(bytes.Repeat([]byte{2}, 32), DefaultCsrfOptions()).newToken()
+
+	tests := []struct {
+		name      string
+		method    string
+		cookie    string
+		header    string
+		form      string
+		status    int
+		setCookie bool
+	}{
+		{
+			name:      "safe request without cookie receives a token",
+			method:    http.MethodGet,
+			status:    http.StatusOK,
+			setCookie: true,
+		},
+		{
+			name:   "safe request with valid cookie",
+			method: http.MethodGet,
+			cookie: token,
+			status: http.StatusOK,
+		},
+		{
+			name:   "unsafe request without token",
+			method: http.MethodPost,
+			cookie: token,
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "unsafe request without cookie",
+			method: http.MethodPost,
+			header: token,
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "unsafe request with matching header",
+			method: http.MethodPost,
+			cookie: token,
+			header: token,
+			status: http.StatusOK,
+		},
+		{
+			name:   "unsafe request with matching form field",
+			method: http.MethodPost,
+			cookie: token,
+			form:   token,
+			status: http.StatusOK,
+		},
+		{
+			name:   "unsafe request with mismatching header",
+			method: http.MethodPost,
+			cookie: token,
+			header: p.newToken(),
+			status: http.StatusForbidden,
+		},
+		{
+			name:   "cookie signed with another key",
+			method: http.MethodPost,
+			cookie: forged,
+			header: forged,
+			status: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			handler := p.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = CsrfToken(r.Context())
+			}))
+
+			req := httptest.NewRequest(tt.method, "/", strings.NewReader(url.Values{"csrf_token": {tt.form}}.Encode()))
+			if tt.form != "" {
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: "csrf_token", Value: tt.cookie})
+			}
+			if tt.header != "" {
+				req.Header.Set("X-CSRF-Token", tt.header)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if setCookie := len(rec.Result().Cookies()) == 1; setCookie != tt.setCookie {
+				t.Errorf("token cookie set = %t, want %t", setCookie, tt.setCookie)
+			}
+			if tt.status == http.StatusOK && !p.valid(seen) {
+				t.Errorf("CsrfToken() = %q is not a valid token", seen)
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package server
+
+const (
+	ErrCertificateNotFoundMessage     = "no certificate found for server name"
+	ErrCsrfTokenInvalidMessage        = "csrf token is invalid"
+	ErrIdempotencyKeyNotFoundMessage  = "idempotency key not found"
+	ErrJobKindUnknownMessage          = "job kind is not registered"
+	ErrJobManagerStoppedMessage       = "job manager is stopped"
+	ErrJobNotFinishedMessage          = "job has not finished"
+	ErrJobNotFoundMessage             = "job not found"
+	ErrJobQueueFullMessage            = "job queue is full"
+	ErrMaintenanceEnabledMessage      = "maintenance mode is enabled"
+	ErrServerClosedMessage            = "server closed"
+	ErrSessionExpiredMessage          = "session has expired"
+	ErrSessionInvalidMessage          = "session cookie is invalid"
+	ErrSessionKeyInvalidMessage       = "session key is invalid"
+	ErrSessionNotFoundMessage         = "session not found"
+	ErrSessionTooLargeMessage         = "session exceeds the cookie size limit"
+	ErrSseNotSupportedMessage         = "response writer does not support streaming"
+	ErrWebSocketClosedMessage         = "websocket connection closed"
+	ErrWebSocketHandshakeMessage      = "websocket handshake failed"
+	ErrWebSocketInvalidPayloadMessage = "websocket payload is invalid"
+	ErrWebSocketMessageTooBigMessage  = "websocket message exceeds size limit"
+	ErrWebSocketProtocolErrorMessage  = "websocket protocol error"
+)
+
+var (
+	ErrCertificateNotFound     = CertificateNotFoundError{message: ErrCertificateNotFoundMessage}
+	ErrCsrfTokenInvalid        = CsrfTokenInvalidError{message: ErrCsrfTokenInvalidMessage}
+	ErrIdempotencyKeyNotFound  = IdempotencyKeyNotFoundError{message: ErrIdempotencyKeyNotFoundMessage}
+	ErrJobKindUnknown          = JobKindUnknownError{message: ErrJobKindUnknownMessage}
+	ErrJobManagerStopped       = JobManagerStoppedError{message: ErrJobManagerStoppedMessage}
+	ErrJobNotFinished          = JobNotFinishedError{message: ErrJobNotFinishedMessage}
+	ErrJobNotFound             = JobNotFoundError{message: ErrJobNotFoundMessage}
+	ErrJobQueueFull            = JobQueueFullError{message: ErrJobQueueFullMessage}
+	ErrMaintenanceEnabled      = MaintenanceEnabledError{message: ErrMaintenanceEnabledMessage}
+	ErrServerClosed            = ServerClosedError{message: ErrServerClosedMessage}
+	ErrSessionExpired          = SessionExpiredError{message: ErrSessionExpiredMessage}
+	ErrSessionInvalid          = SessionInvalidError{message: ErrSessionInvalidMessage}
+	ErrSessionKeyInvalid       = SessionKeyInvalidError{message: ErrSessionKeyInvalidMessage}
+	ErrSessionNotFound         = SessionNotFoundError{message: ErrSessionNotFoundMessage}
+	ErrSessionTooLarge         = SessionTooLargeError{message: ErrSessionTooLargeMessage}
+	ErrSseNotSupported         = SseNotSupportedError{message: ErrSseNotSupportedMessage}
+	ErrWebSocketClosed         = WebSocketClosedError{message: ErrWebSocketClosedMessage}
+	ErrWebSocketHandshake      = WebSocketHandshakeError{message: ErrWebSocketHandshakeMessage}
+	ErrWebSocketInvalidPayload = WebSocketInvalidPayloadError{message: ErrWebSocketInvalidPayloadMessage}
+	ErrWebSocketMessageTooBig  = WebSocketMessageTooBigError{message: ErrWebSocketMessageTooBigMessage}
+	ErrWebSocketProtocolError  = WebSocketProtocolError{message: ErrWebSocketProtocolErrorMessage}
+)
+
+type CertificateNotFoundError struct {
+	message string
+}
+
+func (e CertificateNotFoundError) Error() string {
+	return e.message
+}
+
+type CsrfTokenInvalidError struct {
+	message string
+}
+
+func (e CsrfTokenInvalidError) Error() string {
+	return e.message
+}
+
+type IdempotencyKeyNotFoundError struct {
+	message string
+}
+
+func (e IdempotencyKeyNotFoundError) Error() string {
+	return e.message
+}
+
+type JobKindUnknownError struct {
+	message string
+}
+
+func (e JobKindUnknownError) Error() string {
+	return e.message
+}
+
+type JobManagerStoppedError struct {
+	message string
+}
+
+func (e JobManagerStoppedError) Error() string {
+	return e.message
+}
+
+type JobNotFinishedError struct {
+	message string
+}
+
+func (e JobNotFinishedError) Error() string {
+	return e.message
+}
+
+type JobNotFoundError struct {
+	message string
+}
+
+func (e JobNotFoundError) Error() string {
+	return e.message
+}
+
+type JobQueueFullError struct {
+	message string
+}
+
+func (e JobQueueFullError) Error() string {
+	return e.message
+}
+
+type MaintenanceEnabledError struct {
+	message string
+}
+
+func (e MaintenanceEnabledError) Error() string {
+	return e.message
+}
+
+type ServerClosedError struct {
+	message string
+}
+
+func (e ServerClosedError) Error() string {
+	return e.message
+}
+
+type SessionExpiredError struct {
+	message string
+}
+
+func (e SessionExpiredError) Error() string {
+	return e.message
+}
+
+type SessionInvalidError struct {
+	message string
+}
+
+func (e SessionInvalidError) Error() string {
+	return e.message
+}
+
+type SessionKeyInvalidError struct {
+	message string
+}
+
+func (e SessionKeyInvalidError) Error() string {
+	return e.message
+}
+
+type SessionNotFoundError struct {
+	message string
+}
+
+func (e SessionNotFoundError) Error() string {
+	return e.message
+}
+
+type SessionTooLargeError struct {
+	message string
+}
+
+func (e SessionTooLargeError) Error() string {
+	return e.message
+}
+
+type SseNotSupportedError struct {
+	message string
+}
+
+func (e SseNotSupportedError) Error() string {
+	return e.message
+}
+
+type WebSocketClosedError struct {
+	message string
+}
+
+func (e WebSocketClosedError) Error() string {
+	return e.message
+}
+
+type WebSocketHandshakeError struct {
+	message string
+}
+
+func (e WebSocketHandshakeError) Error() string {
+	return e.message
+}
+
+type WebSocketInvalidPayloadError struct {
+	message string
+}
+
+func (e WebSocketInvalidPayloadError) Error() string {
+	return e.message
+}
+
+type WebSocketMessageTooBigError struct {
+	message string
+}
+
+func (e WebSocketMessageTooBigError) Error() string {
+	return e.message
+}
+
+type WebSocketProtocolError struct {
+	message string
+}
+
+func (e WebSocketProtocolError) Error() string {
+	return e.message
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type HealthCheck func(ctx context.Context) error
+
+func NewHealth() *Health {
+	return &Health{
+		readiness: make(map[string]HealthCheck),
+		Timeout:   5 * time.Second,
+	}
+}
+
+// Health serves liveness and readiness endpoints, readiness is reported as failed when any registered check fails
+type Health struct {
+	Timeout   time.Duration
+	readiness map[string]HealthCheck
+	mux       sync.RWMutex
+}
+
+func (h *Health) AddReadinessCheck(name string, check HealthCheck) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	h.readiness[name] = check
+}
+
+func (h *Health) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJson(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+}
+
+func (h *Health) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), h.Timeout)
+		defer cancel()
+
+		failures := h.Ready(ctx)
+		if len(failures) > 0 {
+			writeJson(w, http.StatusServiceUnavailable, map[string]any{"status": "unavailable", "checks": failures})
+			return
+		}
+		writeJson(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+}
+
+// Ready runs all readiness checks and returns the error message per failing check
+func (h *Health) Ready(ctx context.Context) map[string]string {
+	h.mux.RLock()
+	defer h.mux.RUnlock()
+
+	failures := make(map[string]string)
+	for name, check := range h.readiness {
+		if err := check(ctx); err != nil {
+			failures[name] = err.Error()
+		}
+	}
+	return failures
+}
@@ -20,31 +20,45 @@ import (
 	"context"
 	"errors"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
-	"os/signal"
 	"strconv"
-	"syscall"
+	"sync"
 	"time"
 )
 
 func NewHttpServer(address string, port int, handler http.Handler) *HttpServer {
-	return &HttpServer{
-		Server: &http.Server{
-			Addr:    address + ":" + strconv.Itoa(port),
-			Handler: handler},
-	}
+	return newHttpServer(address, port, handler)
 }
 
 func NewTlsHttpServer(address string, port int, pubKey string, privKey string, handler http.Handler) *HttpServer {
+	s := newHttpServer(address, port, handler)
+	s.UseTls = pubKey != "" && privKey != ""
+	s.PublicKey = pubKey
+	s.PrivateKey = privKey
+	return s
+}
+
+// NewSniHttpServer creates a TLS server selecting the certificate for every connection from store, based on the SNI server name
+func NewSniHttpServer(address string, port int, store *CertificateStore, handler http.Handler) *HttpServer {
+	s := newHttpServer(address, port, handler)
+	s.UseTls = true
+	s.Server.TLSConfig = store.TlsConfig()
+	return s
+}
+
+const defaultHttpShutdownTimeout = 30 * time.Second
+
+func newHttpServer(address string, port int, handler http.Handler) *HttpServer {
 	return &HttpServer{
 		Server: &http.Server{
 			Addr:    address + ":" + strconv.Itoa(port),
 			Handler: handler,
 		},
-		UseTls:     pubKey != "" && privKey != "",
-		PublicKey:  pubKey,
-		PrivateKey: privKey,
+		Tracker:                  NewConnTracker(),
+		ShutdownTimeout:          defaultHttpShutdownTimeout,
+		ShutdownProgressInterval: 5 * time.Second,
 	}
 }
 
@@ -53,24 +67,113 @@ type HttpServer struct {
 	UseTls     bool
 	PublicKey  string
 	PrivateKey string
+
+	Tracker                     *ConnTracker
+	ShutdownTimeout             time.Duration
+	ShutdownProgressInterval    time.Duration
+	DisableKeepAlivesOnShutdown bool
+
+	drainCtx    context.Context
+	drainCancel context.CancelFunc
+	drainFuncs  []func(ctx context.Context) error
+	maintenance *Maintenance
+	stop        chan struct{}
+	stopOnce    sync.Once
+	initOnce    sync.Once
 }
 
-func (s *HttpServer) RunServer(ctx context.Context) {
-	// HttpServer run context
-	serverCtx, serverStopCtx := context.WithCancel(ctx)
+type shutdownContextKey struct{}
+
+// ShutdownContext returns a context which is cancelled when the server handling the request starts shutting down.
+// Long-running handlers can use it to finish their work early, the request context itself remains valid during the drain.
+// Outside of an HttpServer the returned context is never cancelled.
+func ShutdownContext(ctx context.Context) context.Context {
+	if drainCtx, ok := ctx.Value(shutdownContextKey{}).(context.Context); ok {
+		return drainCtx
+	}
+	return context.Background()
+}
+
+// init wires connection tracking and the shutdown context into the http server.
+// It runs lazily, so an HttpServer which was not created by one of the constructors can be used as well.
+func (s *HttpServer) init() {
+	s.initOnce.Do(func() {
+		if s.Tracker == nil {
+			s.Tracker = NewConnTracker()
+		}
+		s.drainCtx, s.drainCancel = context.WithCancel(context.Background())
+		s.stop = make(chan struct{})
+
+		connState := s.Server.ConnState
+		s.Server.ConnState = func(c net.Conn, state http.ConnState) {
+			s.Tracker.ConnState(c, state)
+			if connState != nil {
+				connState(c, state)
+			}
+		}
+
+		baseContext := s.Server.BaseContext
+		s.Server.BaseContext = func(l net.Listener) context.Context {
+			ctx := context.Background()
+			if baseContext != nil {
+				ctx = baseContext(l)
+			}
+			return context.WithValue(ctx, shutdownContextKey{}, s.drainCtx)
+		}
+	})
+}
 
-	// Listen for syscall signals for process to interrupt/quit
-	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+// RegisterWebSocketUpgrader makes sure all connections upgraded by u receive a close frame when the server shuts down
+func (s *HttpServer) RegisterWebSocketUpgrader(u *WebSocketUpgrader) {
+	s.Server.RegisterOnShutdown(func() {
+		u.CloseAll(WebSocketCloseGoingAway, "server shutting down")
+	})
+}
 
-	go s.shutdown(&serverCtx, serverStopCtx, &sig)
-	go s.start()
+// RegisterDrainFunc registers f to be called while the server shuts down, e.g. JobManager.Drain.
+// All drain functions run concurrently with the http server shutdown and share its grace period.
+func (s *HttpServer) RegisterDrainFunc(f func(ctx context.Context) error) {
+	s.drainFuncs = append(s.drainFuncs, f)
+}
 
-	// Wait for server context to be stopped
-	<-serverCtx.Done()
+// UseMaintenance puts m in front of the handler, its marker file is watched until the server shuts down
+func (s *HttpServer) UseMaintenance(m *Maintenance) {
+	s.init()
+	s.Server.Handler = m.Middleware(s.Server.Handler)
+	s.maintenance = m
+	go m.Watch(s.drainCtx)
+}
+
+func (s *HttpServer) RunServer(ctx context.Context) {
+	s.init()
+	runServer(ctx, s.stop, s.start, s.shutdown)
+}
+
+// Stop triggers the same graceful shutdown as a termination signal, RunServer returns once it has completed
+func (s *HttpServer) Stop() {
+	s.init()
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+}
+
+func (s *HttpServer) Status() map[string]any {
+	s.init()
+	status := map[string]any{
+		"address":     s.protocol() + s.Server.Addr,
+		"connections": s.Tracker.Connections(),
+		"requests":    s.Tracker.InFlight(),
+	}
+	if s.maintenance != nil {
+		status["maintenance"] = s.maintenance.Enabled()
+	}
+	return status
 }
 
 func (s *HttpServer) start() {
+	// Wrap the handler when serving starts, so a handler assigned after construction is tracked as well
+	s.Server.Handler = s.Tracker.Middleware(s.Server.Handler)
+
 	switch s.UseTls {
 	case true:
 		s.listenAndServeTls()
@@ -80,37 +183,82 @@ func (s *HttpServer) start() {
 
 }
 
-func (s *HttpServer) shutdown(c *context.Context, cancelFunc context.CancelFunc, sig *chan os.Signal) {
-	<-*sig
-	var protocol string
-	switch s.UseTls {
-	case true:
-		protocol = "https://"
-	case false:
-		protocol = "http://"
+func (s *HttpServer) shutdown(c context.Context) {
+	address := s.protocol() + s.Server.Addr
+
+	// Signal handlers that the server is draining
+	s.drainCancel()
+
+	// Disabling keep-alives closes the idle connections and makes active ones close after their current response
+	if s.DisableKeepAlivesOnShutdown {
+		s.Server.SetKeepAlivesEnabled(false)
 	}
 
-	// Shutdown signal with grace period of 30 seconds
-	shutdownCtx, cancel := context.WithTimeout(*c, 30*time.Second)
+	timeout := s.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = defaultHttpShutdownTimeout
+	}
+
+	// Shutdown signal with grace period
+	shutdownCtx, cancel := context.WithTimeout(c, timeout)
 	defer cancel()
 
 	go func(ctx context.Context, address string) {
 		<-ctx.Done()
 		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
-			slog.Error("graceful shutdown timed out", "address", address, "error", ctx.Err())
+			slog.Error("graceful shutdown timed out", "address", address, "connections", s.Tracker.Connections(), "requests", s.Tracker.InFlight(), "error", ctx.Err())
 			os.Exit(1)
 		}
-	}(shutdownCtx, protocol+s.Server.Addr)
+	}(shutdownCtx, address)
+
+	slog.Info("shutting down server", "address", address, "connections", s.Tracker.Connections(), "requests", s.Tracker.InFlight())
+	go s.logShutdownProgress(shutdownCtx, address)
+
+	// Drain registered components while the http server shuts down
+	var wg sync.WaitGroup
+	for _, f := range s.drainFuncs {
+		wg.Add(1)
+		go func(f func(ctx context.Context) error) {
+			defer wg.Done()
+			if err := f(shutdownCtx); err != nil {
+				slog.Error("could not drain component", "address", address, "error", err)
+			}
+		}(f)
+	}
 
-	slog.Info("shutting down server", "address", protocol+s.Server.Addr)
 	// Trigger graceful shutdown
 	err := s.Server.Shutdown(shutdownCtx)
 	if err != nil {
-		slog.Error("could not shutdown server", "address", protocol+s.Server.Addr, "error", err)
+		slog.Error("could not shutdown server", "address", address, "error", err)
 	}
+	wg.Wait()
+}
 
-	// Call parent context cancel function to complete graceful exit
-	cancelFunc()
+func (s *HttpServer) logShutdownProgress(ctx context.Context, address string) {
+	if s.ShutdownProgressInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.ShutdownProgressInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			slog.Info("draining server", "address", address, "active", s.Tracker.ActiveConnections(), "connections", s.Tracker.Connections(), "requests", s.Tracker.InFlight())
+		}
+	}
+}
+
+func (s *HttpServer) protocol() string {
+	switch s.UseTls {
+	case true:
+		return "https://"
+	default:
+		return "http://"
+	}
 }
 
 func (s *HttpServer) listenAndServe() {
@@ -0,0 +1,197 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+type IdempotencyOptions struct {
+	HeaderName string
+	Methods    []string
+	Ttl        time.Duration
+	// Required rejects mutating requests without an idempotency key
+	Required bool
+	// MaxKeyLength limits the size of keys accepted from clients
+	MaxKeyLength int
+	// MaxBodySize limits the request body size which is read to fingerprint the request
+	MaxBodySize int64
+}
+
+func DefaultIdempotencyOptions() IdempotencyOptions {
+	return IdempotencyOptions{
+		HeaderName:   "Idempotency-Key",
+		Methods:      []string{http.MethodPost, http.MethodPatch},
+		Ttl:          24 * time.Hour,
+		MaxKeyLength: 255,
+		MaxBodySize:  1 << 20,
+	}
+}
+
+// NewIdempotency creates the middleware, zero values in o are replaced by their defaults
+func NewIdempotency(store IdempotencyStore, o IdempotencyOptions) *Idempotency {
+	defaults := DefaultIdempotencyOptions()
+	if o.HeaderName == "" {
+		o.HeaderName = defaults.HeaderName
+	}
+	if o.Methods == nil {
+		o.Methods = defaults.Methods
+	}
+	if o.MaxKeyLength <= 0 {
+		o.MaxKeyLength = defaults.MaxKeyLength
+	}
+	if o.Ttl <= 0 {
+		o.Ttl = defaults.Ttl
+	}
+	if o.MaxBodySize <= 0 {
+		o.MaxBodySize = defaults.MaxBodySize
+	}
+	return &Idempotency{
+		store:   store,
+		options: o,
+	}
+}
+
+// Idempotency makes retried requests carrying the same idempotency key return the response of the first request,
+// instead of executing the handler again.
+type Idempotency struct {
+	store   IdempotencyStore
+	options IdempotencyOptions
+}
+
+func (i *Idempotency) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !slices.Contains(i.options.Methods, r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := r.Header.Get(i.options.HeaderName)
+		if key == "" {
+			if i.options.Required {
+				http.Error(w, "missing "+i.options.HeaderName+" header", http.StatusBadRequest)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > i.options.MaxKeyLength {
+			http.Error(w, "invalid "+i.options.HeaderName+" header", http.StatusBadRequest)
+			return
+		}
+
+		fingerprint, err := i.fingerprint(w, r)
+		if err != nil {
+			if errors.As(err, new(*http.MaxBytesError)) {
+				http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		record, reserved, err := i.store.Reserve(r.Context(), key, fingerprint, i.options.Ttl)
+		if err != nil {
+			slog.Error("could not reserve idempotency key", "error", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		if !reserved {
+			switch {
+			case record.Fingerprint != fingerprint:
+				http.Error(w, i.options.HeaderName+" was used with a different request", http.StatusUnprocessableEntity)
+			case !record.Completed:
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, "a request with the same "+i.options.HeaderName+" is in progress", http.StatusConflict)
+			default:
+				i.replay(w, record)
+			}
+			return
+		}
+
+		i.serve(w, r, next, key, fingerprint)
+	})
+}
+
+func (i *Idempotency) serve(w http.ResponseWriter, r *http.Request, next http.Handler, key string, fingerprint string) {
+	completed := false
+	defer func() {
+		// Release the key when the handler panics or fails, so the client can retry the request
+		if !completed {
+			if err := i.store.Release(r.Context(), key); err != nil {
+				slog.Error("could not release idempotency key", "error", err)
+			}
+		}
+	}()
+
+	recorder := newResponseRecorder(w, true)
+	next.ServeHTTP(recorder, r)
+
+	if recorder.Status() >= http.StatusInternalServerError {
+		return
+	}
+
+	header := recorder.Header().Clone()
+	header.Del("Date")
+	record := IdempotencyRecord{
+		Fingerprint: fingerprint,
+		Completed:   true,
+		Status:      recorder.Status(),
+		Header:      header,
+		Body:        recorder.body.Bytes(),
+	}
+	if err := i.store.Complete(r.Context(), key, record, i.options.Ttl); err != nil {
+		slog.Error("could not store idempotent response", "error", err)
+		return
+	}
+	completed = true
+}
+
+func (i *Idempotency) replay(w http.ResponseWriter, record IdempotencyRecord) {
+	for k, v := range record.Header {
+		w.Header()[k] = v
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.Header().Set("Content-Length", strconv.Itoa(len(record.Body)))
+	w.WriteHeader(record.Status)
+	_, _ = w.Write(record.Body)
+}
+
+func (i *Idempotency) fingerprint(w http.ResponseWriter, r *http.Request) (string, error) {
+	h := sha256.New()
+	h.Write([]byte(r.Method + "\n" + r.URL.RequestURI() + "\n"))
+
+	if r.Body != nil {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, i.options.MaxBodySize))
+		if err != nil {
+			return "", err
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		h.Write(body)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,133 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type IdempotencyRecord struct {
+	Fingerprint string
+	Completed   bool
+	Status      int
+	Header      http.Header
+	Body        []byte
+}
+
+type IdempotencyStore interface {
+	// Reserve locks key for a request with the given fingerprint.
+	// When the key is already known, the existing record is returned and reserved is false.
+	Reserve(ctx context.Context, key string, fingerprint string, ttl time.Duration) (record IdempotencyRecord, reserved bool, err error)
+	// Complete stores the response for a reserved key.
+	// The response must also be stored when the reservation expired while the request was being handled,
+	// unless the key has been reserved by a different request in the meantime.
+	Complete(ctx context.Context, key string, record IdempotencyRecord, ttl time.Duration) error
+	// Release removes the reservation of a key
+	Release(ctx context.Context, key string) error
+}
+
+// memoryIdempotencyCleanupInterval limits how often expired records are evicted while reserving or completing keys
+const memoryIdempotencyCleanupInterval = time.Minute
+
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		records: make(map[string]storedIdempotencyRecord),
+	}
+}
+
+// MemoryIdempotencyStore keeps records in memory, expired records are evicted periodically while the store is used
+type MemoryIdempotencyStore struct {
+	records     map[string]storedIdempotencyRecord
+	lastCleanup time.Time
+	mux         sync.Mutex
+}
+
+type storedIdempotencyRecord struct {
+	record  IdempotencyRecord
+	expires time.Time
+}
+
+func (m *MemoryIdempotencyStore) Reserve(_ context.Context, key string, fingerprint string, ttl time.Duration) (IdempotencyRecord, bool, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.evictExpired()
+	if stored, found := m.records[key]; found && time.Now().Before(stored.expires) {
+		return stored.record, false, nil
+	}
+
+	record := IdempotencyRecord{
+		Fingerprint: fingerprint,
+	}
+	m.records[key] = storedIdempotencyRecord{
+		record:  record,
+		expires: time.Now().Add(ttl),
+	}
+	return record, true, nil
+}
+
+func (m *MemoryIdempotencyStore) Complete(_ context.Context, key string, record IdempotencyRecord, ttl time.Duration) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.evictExpired()
+	if stored, found := m.records[key]; found && stored.record.Fingerprint != record.Fingerprint {
+		return ErrIdempotencyKeyNotFound
+	}
+	m.records[key] = storedIdempotencyRecord{
+		record:  record,
+		expires: time.Now().Add(ttl),
+	}
+	return nil
+}
+
+func (m *MemoryIdempotencyStore) Release(_ context.Context, key string) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	delete(m.records, key)
+	return nil
+}
+
+// Cleanup removes all expired records from the store
+func (m *MemoryIdempotencyStore) Cleanup() {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.removeExpired(time.Now())
+}
+
+// evictExpired removes expired records at most once per cleanup interval, the caller must hold the lock
+func (m *MemoryIdempotencyStore) evictExpired() {
+	now := time.Now()
+	if now.Sub(m.lastCleanup) < memoryIdempotencyCleanupInterval {
+		return
+	}
+	m.removeExpired(now)
+}
+
+func (m *MemoryIdempotencyStore) removeExpired(now time.Time) {
+	for key, stored := range m.records {
+		if now.After(stored.expires) {
+			delete(m.records, key)
+		}
+	}
+	m.lastCleanup = now
+}
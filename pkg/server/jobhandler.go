@@ -0,0 +1,118 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+type jobRequest struct {
+	Kind    string          `json:"kind"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// Handler serves the job API below prefix:
+//
+//	POST   {prefix}                submit a job
+//	GET    {prefix}/{id}           job status
+//	DELETE {prefix}/{id}           cancel a job
+//	GET    {prefix}/{id}/result    job result
+func (m *JobManager) Handler(prefix string) http.Handler {
+	prefix = strings.TrimSuffix(prefix, "/")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(http.MethodPost+" "+prefix, func(w http.ResponseWriter, r *http.Request) {
+		var req jobRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, m.options.MaxRequestSize)).Decode(&req); err != nil {
+			if errors.As(err, new(*http.MaxBytesError)) {
+				writeBodyTooLarge(w, r, m.options.MaxRequestSize)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		job, err := m.Submit(req.Kind, req.Payload)
+		if err != nil {
+			writeJobError(w, err)
+			return
+		}
+		w.Header().Set("Location", prefix+"/"+job.Id)
+		writeJson(w, http.StatusAccepted, job)
+	})
+	mux.HandleFunc(http.MethodGet+" "+prefix+"/{id}", func(w http.ResponseWriter, r *http.Request) {
+		job, err := m.Get(r.PathValue("id"))
+		if err != nil {
+			writeJobError(w, err)
+			return
+		}
+		writeJson(w, http.StatusOK, job)
+	})
+	mux.HandleFunc(http.MethodDelete+" "+prefix+"/{id}", func(w http.ResponseWriter, r *http.Request) {
+		job, err := m.Cancel(r.PathValue("id"))
+		if err != nil {
+			writeJobError(w, err)
+			return
+		}
+		writeJson(w, http.StatusAccepted, job)
+	})
+	mux.HandleFunc(http.MethodGet+" "+prefix+"/{id}/result", func(w http.ResponseWriter, r *http.Request) {
+		job, err := m.Get(r.PathValue("id"))
+		if err != nil {
+			writeJobError(w, err)
+			return
+		}
+		if !job.State.Finished() {
+			writeJobError(w, ErrJobNotFinished)
+			return
+		}
+		// Failed and cancelled jobs have no result, return the job with its error instead
+		if job.State != JobSucceeded {
+			writeJson(w, http.StatusConflict, job)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(job.Result)
+	})
+	return mux
+}
+
+func writeJobError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrJobNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrJobKindUnknown):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrJobNotFinished):
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, ErrJobQueueFull), errors.Is(err, ErrJobManagerStopped):
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func writeJson(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
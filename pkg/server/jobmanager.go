@@ -0,0 +1,520 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+type JobState string
+
+const (
+	JobPending   JobState = "pending"
+	JobRunning   JobState = "running"
+	JobSucceeded JobState = "succeeded"
+	JobFailed    JobState = "failed"
+	JobCancelled JobState = "cancelled"
+)
+
+func (s JobState) Finished() bool {
+	return s == JobSucceeded || s == JobFailed || s == JobCancelled
+}
+
+type Job struct {
+	Id       string          `json:"id"`
+	Kind     string          `json:"kind"`
+	Payload  json.RawMessage `json:"payload,omitempty"`
+	State    JobState        `json:"state"`
+	Progress float64         `json:"progress"`
+	Message  string          `json:"message,omitempty"`
+	Result   json.RawMessage `json:"result,omitempty"`
+	Error    string          `json:"error,omitempty"`
+	Created  time.Time       `json:"created"`
+	Started  *time.Time      `json:"started,omitempty"`
+	Finished *time.Time      `json:"finished,omitempty"`
+}
+
+// JobProgressFunc reports the progress of a job as a percentage with an optional message
+type JobProgressFunc func(percent float64, message string)
+
+// JobFunc executes a job, the returned result is stored as JSON.
+// Jobs must stop when ctx is cancelled, which happens when the job is cancelled or the drain window expires.
+type JobFunc func(ctx context.Context, payload json.RawMessage, progress JobProgressFunc) (any, error)
+
+type JobManagerOptions struct {
+	Workers      int
+	QueueSize    int
+	DrainTimeout time.Duration
+	// Retention is the time finished jobs are kept in memory and in the store
+	Retention time.Duration
+	// MaxRequestSize limits the size of a job submitted through Handler
+	MaxRequestSize int64
+}
+
+func DefaultJobManagerOptions() JobManagerOptions {
+	return JobManagerOptions{
+		Workers:        4,
+		QueueSize:      100,
+		DrainTimeout:   20 * time.Second,
+		Retention:      24 * time.Hour,
+		MaxRequestSize: 1 << 20,
+	}
+}
+
+// jobCleanupInterval is the interval at which finished jobs are checked against the retention
+const jobCleanupInterval = time.Minute
+
+// NewJobManager creates a manager running jobs from store, zero values for Workers, QueueSize, Retention and
+// MaxRequestSize are replaced by their defaults.
+func NewJobManager(store JobStore, o JobManagerOptions) *JobManager {
+	defaults := DefaultJobManagerOptions()
+	if o.Workers <= 0 {
+		o.Workers = defaults.Workers
+	}
+	if o.QueueSize <= 0 {
+		o.QueueSize = defaults.QueueSize
+	}
+	if o.Retention <= 0 {
+		o.Retention = defaults.Retention
+	}
+	if o.MaxRequestSize <= 0 {
+		o.MaxRequestSize = defaults.MaxRequestSize
+	}
+	return &JobManager{
+		store:   store,
+		options: o,
+		kinds:   make(map[string]JobFunc),
+		jobs:    make(map[string]*jobEntry),
+		queue:   make(chan string, o.QueueSize),
+		stop:    make(chan struct{}),
+	}
+}
+
+type JobManager struct {
+	store   JobStore
+	options JobManagerOptions
+	kinds   map[string]JobFunc
+	jobs    map[string]*jobEntry
+	queue   chan string
+	stop    chan struct{}
+	workers sync.WaitGroup
+
+	started  bool
+	draining bool
+	mux      sync.Mutex
+	// saveMux serializes writes to the store, so the store is not accessed while holding mux
+	saveMux sync.Mutex
+}
+
+type jobEntry struct {
+	job       Job
+	cancel    context.CancelFunc
+	cancelled bool
+}
+
+func (m *JobManager) Register(kind string, fn JobFunc) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.kinds[kind] = fn
+}
+
+// Start restores persisted jobs and starts the workers, jobs interrupted by a previous shutdown are queued again.
+// Calling Start on a manager which has already been started has no effect.
+func (m *JobManager) Start() error {
+	m.mux.Lock()
+	if m.started {
+		m.mux.Unlock()
+		return nil
+	}
+	m.started = true
+	m.mux.Unlock()
+
+	jobs, err := m.store.List()
+	if err != nil {
+		m.mux.Lock()
+		m.started = false
+		m.mux.Unlock()
+		return err
+	}
+
+	m.mux.Lock()
+	resume := make([]string, 0)
+	for _, job := range jobs {
+		if job.State == JobRunning {
+			job.State = JobPending
+			job.Started = nil
+		}
+		m.jobs[job.Id] = &jobEntry{job: job}
+		if job.State == JobPending {
+			resume = append(resume, job.Id)
+		}
+	}
+	m.mux.Unlock()
+
+	for i := 0; i < m.options.Workers; i++ {
+		m.workers.Add(1)
+		go m.worker()
+	}
+
+	go func() {
+		for _, id := range resume {
+			if !m.enqueue(id, true) {
+				return
+			}
+		}
+	}()
+	go m.janitor()
+	slog.Info("job manager started", "workers", m.options.Workers, "resumed", len(resume))
+	return nil
+}
+
+func (m *JobManager) Submit(kind string, payload json.RawMessage) (Job, error) {
+	m.mux.Lock()
+	if m.draining || !m.started {
+		m.mux.Unlock()
+		return Job{}, ErrJobManagerStopped
+	}
+	if _, found := m.kinds[kind]; !found {
+		m.mux.Unlock()
+		return Job{}, ErrJobKindUnknown
+	}
+
+	job := Job{
+		Id:      newJobId(),
+		Kind:    kind,
+		Payload: payload,
+		State:   JobPending,
+		Created: time.Now().UTC(),
+	}
+	m.jobs[job.Id] = &jobEntry{job: job}
+	m.mux.Unlock()
+
+	if err := m.persist(job.Id); err != nil {
+		m.mux.Lock()
+		delete(m.jobs, job.Id)
+		m.mux.Unlock()
+		return Job{}, err
+	}
+
+	if !m.enqueue(job.Id, false) {
+		m.update(job.Id, func(j *Job) {
+			j.State = JobFailed
+			j.Error = ErrJobQueueFullMessage
+		})
+		return Job{}, ErrJobQueueFull
+	}
+	return job, nil
+}
+
+func (m *JobManager) Get(id string) (Job, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	entry, found := m.jobs[id]
+	if !found {
+		return Job{}, ErrJobNotFound
+	}
+	return entry.job, nil
+}
+
+func (m *JobManager) List() []Job {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	output := make([]Job, 0, len(m.jobs))
+	for _, entry := range m.jobs {
+		output = append(output, entry.job)
+	}
+	return output
+}
+
+// Cancel stops a pending or running job, finished jobs are left untouched
+func (m *JobManager) Cancel(id string) (Job, error) {
+	m.mux.Lock()
+	entry, found := m.jobs[id]
+	if !found {
+		m.mux.Unlock()
+		return Job{}, ErrJobNotFound
+	}
+	// A running job finishes as cancelled once its function returns
+	if cancel := entry.cancel; cancel != nil {
+		entry.cancelled = true
+		job := entry.job
+		m.mux.Unlock()
+		cancel()
+		return job, nil
+	}
+	if entry.job.State != JobPending {
+		m.mux.Unlock()
+		return entry.job, nil
+	}
+
+	// A pending job is cancelled under the same lock a worker uses to start it, so it can never start running
+	entry.cancelled = true
+	entry.job.State = JobCancelled
+	entry.job.Finished = timePointer(time.Now().UTC())
+	job := entry.job
+	m.mux.Unlock()
+
+	return job, m.persist(id)
+}
+
+// Drain stops accepting jobs and waits for running jobs to complete within the drain timeout.
+// Jobs which are still running afterwards are interrupted and resumed when the manager is started again.
+func (m *JobManager) Drain(ctx context.Context) error {
+	m.mux.Lock()
+	if m.draining || !m.started {
+		m.mux.Unlock()
+		return nil
+	}
+	m.draining = true
+	close(m.stop)
+	m.mux.Unlock()
+
+	if m.options.DrainTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.options.DrainTimeout)
+		defer cancel()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		m.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		slog.Info("job manager drained")
+		return nil
+	case <-ctx.Done():
+	}
+
+	m.mux.Lock()
+	interrupted := 0
+	for _, entry := range m.jobs {
+		if entry.cancel != nil {
+			entry.cancel()
+			interrupted++
+		}
+	}
+	m.mux.Unlock()
+	slog.Warn("job drain window expired, interrupting running jobs", "count", interrupted)
+
+	<-done
+	return ctx.Err()
+}
+
+// janitor removes finished jobs once they exceed the retention, until the manager is drained
+func (m *JobManager) janitor() {
+	ticker := time.NewTicker(jobCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		m.cleanup(time.Now())
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *JobManager) cleanup(now time.Time) {
+	m.mux.Lock()
+	expired := make([]string, 0)
+	for id, entry := range m.jobs {
+		if !entry.job.State.Finished() || entry.job.Finished == nil || now.Sub(*entry.job.Finished) < m.options.Retention {
+			continue
+		}
+		delete(m.jobs, id)
+		expired = append(expired, id)
+	}
+	m.mux.Unlock()
+
+	m.saveMux.Lock()
+	defer m.saveMux.Unlock()
+
+	// A job which could not be deleted is restored and removed again after the next start
+	for _, id := range expired {
+		if err := m.store.Delete(id); err != nil {
+			slog.Error("could not delete expired job", "id", id, "error", err)
+		}
+	}
+}
+
+func (m *JobManager) enqueue(id string, wait bool) bool {
+	if !wait {
+		select {
+		case m.queue <- id:
+			return true
+		case <-m.stop:
+			return false
+		default:
+			return false
+		}
+	}
+
+	select {
+	case m.queue <- id:
+		return true
+	case <-m.stop:
+		return false
+	}
+}
+
+func (m *JobManager) worker() {
+	defer m.workers.Done()
+	for {
+		// Queued jobs remain pending when draining, they are resumed after a restart
+		select {
+		case <-m.stop:
+			return
+		case id := <-m.queue:
+			m.run(id)
+		}
+	}
+}
+
+func (m *JobManager) run(id string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	m.mux.Lock()
+	entry, found := m.jobs[id]
+	if !found || entry.cancelled || entry.job.State != JobPending || m.draining {
+		m.mux.Unlock()
+		return
+	}
+	fn := m.kinds[entry.job.Kind]
+	payload := entry.job.Payload
+	if fn != nil {
+		entry.cancel = cancel
+		entry.job.State = JobRunning
+		entry.job.Started = timePointer(time.Now().UTC())
+	}
+	m.mux.Unlock()
+
+	if fn == nil {
+		m.finish(id, nil, ErrJobKindUnknown, false)
+		return
+	}
+	if err := m.persist(id); err != nil {
+		slog.Error("could not update job", "id", id, "error", err)
+	}
+
+	progress := func(percent float64, message string) {
+		_, _ = m.update(id, func(j *Job) {
+			j.Progress = percent
+			j.Message = message
+		})
+	}
+
+	result, err := fn(ctx, payload, progress)
+
+	// Jobs cancelled by the drain timeout instead of a client are resumed after a restart
+	m.mux.Lock()
+	interrupted := ctx.Err() != nil && !entry.cancelled
+	entry.cancel = nil
+	m.mux.Unlock()
+
+	m.finish(id, result, err, interrupted)
+}
+
+func (m *JobManager) finish(id string, result any, err error, interrupted bool) {
+	_, updateErr := m.update(id, func(j *Job) {
+		switch {
+		case interrupted:
+			j.State = JobPending
+			j.Started = nil
+			j.Progress = 0
+			j.Message = "interrupted by shutdown"
+			return
+		case err != nil && errors.Is(err, context.Canceled):
+			j.State = JobCancelled
+		case err != nil:
+			j.State = JobFailed
+			j.Error = err.Error()
+		default:
+			output, marshalErr := json.Marshal(result)
+			if marshalErr != nil {
+				j.State = JobFailed
+				j.Error = marshalErr.Error()
+				break
+			}
+			j.State = JobSucceeded
+			j.Progress = 100
+			j.Result = output
+		}
+		j.Finished = timePointer(time.Now().UTC())
+	})
+	if updateErr != nil {
+		slog.Error("could not update job", "id", id, "error", updateErr)
+	}
+}
+
+func (m *JobManager) update(id string, f func(j *Job)) (Job, error) {
+	m.mux.Lock()
+	entry, found := m.jobs[id]
+	if !found {
+		m.mux.Unlock()
+		return Job{}, ErrJobNotFound
+	}
+	f(&entry.job)
+	job := entry.job
+	m.mux.Unlock()
+
+	return job, m.persist(id)
+}
+
+// persist saves the current state of a job. The state is read while holding saveMux,
+// so concurrent updates can never overwrite a newer state in the store with an older one.
+func (m *JobManager) persist(id string) error {
+	m.saveMux.Lock()
+	defer m.saveMux.Unlock()
+
+	m.mux.Lock()
+	entry, found := m.jobs[id]
+	if !found {
+		// The job expired in the meantime and was removed from the store
+		m.mux.Unlock()
+		return nil
+	}
+	job := entry.job
+	m.mux.Unlock()
+
+	return m.store.Save(job)
+}
+
+func newJobId() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func timePointer(t time.Time) *time.Time {
+	return &t
+}
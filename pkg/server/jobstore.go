@@ -0,0 +1,108 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package server
+
+import (
+	"sync"
+
+	"github.com/corelayer/go-kit/pkg/internal/filestore"
+)
+
+type JobStore interface {
+	Save(job Job) error
+	Load(id string) (Job, error)
+	List() ([]Job, error)
+	Delete(id string) error
+}
+
+func NewMemoryJobStore() *MemoryJobStore {
+	return &MemoryJobStore{
+		jobs: make(map[string]Job),
+	}
+}
+
+type MemoryJobStore struct {
+	jobs map[string]Job
+	mux  sync.Mutex
+}
+
+func (m *MemoryJobStore) Save(job Job) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.jobs[job.Id] = job
+	return nil
+}
+
+func (m *MemoryJobStore) Load(id string) (Job, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	job, found := m.jobs[id]
+	if !found {
+		return Job{}, ErrJobNotFound
+	}
+	return job, nil
+}
+
+func (m *MemoryJobStore) List() ([]Job, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	output := make([]Job, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		output = append(output, job)
+	}
+	return output, nil
+}
+
+func (m *MemoryJobStore) Delete(id string) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	delete(m.jobs, id)
+	return nil
+}
+
+// NewFileJobStore creates a store persisting every job as a JSON file in path
+func NewFileJobStore(path string) (*FileJobStore, error) {
+	files, err := filestore.New[Job](path, ".job", ErrJobNotFound)
+	if err != nil {
+		return nil, err
+	}
+	return &FileJobStore{
+		files: files,
+	}, nil
+}
+
+type FileJobStore struct {
+	files *filestore.Store[Job]
+}
+
+func (f *FileJobStore) Save(job Job) error {
+	return f.files.Save(job.Id, job)
+}
+
+func (f *FileJobStore) Load(id string) (Job, error) {
+	return f.files.Load(id)
+}
+
+func (f *FileJobStore) List() ([]Job, error) {
+	return f.files.List()
+}
+
+func (f *FileJobStore) Delete(id string) error {
+	return f.files.Delete(id)
+}
@@ -0,0 +1,53 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// runServer calls start and blocks until shutdown has completed after receiving a termination signal or a value on stop,
+// or until ctx is cancelled
+func runServer(ctx context.Context, stop <-chan struct{}, start func(), shutdown func(ctx context.Context)) {
+	// Server run context
+	serverCtx, serverStopCtx := context.WithCancel(ctx)
+
+	// Listen for syscall signals for process to interrupt/quit
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	defer signal.Stop(sig)
+
+	go func() {
+		select {
+		case <-sig:
+		case <-stop:
+		case <-serverCtx.Done():
+			return
+		}
+		shutdown(serverCtx)
+
+		// Call parent context cancel function to complete graceful exit
+		serverStopCtx()
+	}()
+	go start()
+
+	// Wait for server context to be stopped
+	<-serverCtx.Done()
+}
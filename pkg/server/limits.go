@@ -0,0 +1,269 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LimitOptions configures the request body size and handler deadline, per route values override the defaults.
+// A value of 0 disables the limit, routes are identified by their pattern when the handler implements RouteResolver,
+// requests to other handlers use the defaults and are counted as "unmatched".
+type LimitOptions struct {
+	MaxBodySize      int64
+	Timeout          time.Duration
+	RouteMaxBodySize map[string]int64
+	RouteTimeouts    map[string]time.Duration
+}
+
+func NewLimits(o LimitOptions) *Limits {
+	return &Limits{
+		options:  o,
+		timeouts: make(map[string]uint64),
+	}
+}
+
+// Limits rejects oversized request bodies with 413 Request Entity Too Large and cancels handlers exceeding their deadline with 503 Service Unavailable.
+// Handlers with a deadline are buffered, streaming routes such as server-sent events and websockets should have their timeout disabled.
+type Limits struct {
+	options  LimitOptions
+	timeouts map[string]uint64
+	mux      sync.Mutex
+}
+
+func (l *Limits) Middleware(next http.Handler) http.Handler {
+	if next == nil {
+		next = http.DefaultServeMux
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeOf(next, r)
+
+		if limit := l.maxBodySize(route); limit > 0 && r.Body != nil && r.Body != http.NoBody {
+			if r.ContentLength > limit {
+				writeBodyTooLarge(w, r, limit)
+				return
+			}
+
+			// Bodies without Content-Length are only known to be too large once read, the response of the handler
+			// is replaced by the same problem as long as it has not written its status yet
+			body := &limitedBody{ReadCloser: http.MaxBytesReader(w, r.Body, limit)}
+			lw := &bodyLimitWriter{ResponseWriter: w, request: r, body: body, limit: limit}
+			r.Body = body
+			w = lw
+			defer lw.finish()
+		}
+
+		timeout := l.timeout(route)
+		if timeout <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		l.serveWithTimeout(w, r, next, route, timeout)
+	})
+}
+
+// Timeouts returns the number of requests which exceeded their deadline per route
+func (l *Limits) Timeouts() map[string]uint64 {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	output := make(map[string]uint64, len(l.timeouts))
+	for route, count := range l.timeouts {
+		output[route] = count
+	}
+	return output
+}
+
+func (l *Limits) serveWithTimeout(w http.ResponseWriter, r *http.Request, next http.Handler, route string, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	tw := &timeoutResponseWriter{
+		header: make(http.Header),
+	}
+	done := make(chan struct{})
+	panicked := make(chan any, 1)
+
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				panicked <- p
+			}
+		}()
+		next.ServeHTTP(tw, r.WithContext(ctx))
+		close(done)
+	}()
+
+	select {
+	case p := <-panicked:
+		panic(p)
+	case <-done:
+		tw.mux.Lock()
+		defer tw.mux.Unlock()
+
+		dst := w.Header()
+		for k, v := range tw.header {
+			dst[k] = v
+		}
+		if tw.status == 0 {
+			tw.status = http.StatusOK
+		}
+		w.WriteHeader(tw.status)
+		_, _ = w.Write(tw.body.Bytes())
+	case <-ctx.Done():
+		tw.mux.Lock()
+		defer tw.mux.Unlock()
+
+		// The client went away, there is nobody to answer
+		if errors.Is(ctx.Err(), context.Canceled) {
+			tw.timedOut = true
+			return
+		}
+
+		l.mux.Lock()
+		l.timeouts[route]++
+		l.mux.Unlock()
+
+		tw.timedOut = true
+		p := NewProblem(http.StatusServiceUnavailable, fmt.Sprintf("request did not complete within %s", timeout))
+		p.Instance = r.URL.Path
+		WriteProblem(w, p)
+	}
+}
+
+func (l *Limits) maxBodySize(route string) int64 {
+	if limit, ok := l.options.RouteMaxBodySize[route]; ok {
+		return limit
+	}
+	return l.options.MaxBodySize
+}
+
+func (l *Limits) timeout(route string) time.Duration {
+	if timeout, ok := l.options.RouteTimeouts[route]; ok {
+		return timeout
+	}
+	return l.options.Timeout
+}
+
+func writeBodyTooLarge(w http.ResponseWriter, r *http.Request, limit int64) {
+	p := NewProblem(http.StatusRequestEntityTooLarge, fmt.Sprintf("request body exceeds %d bytes", limit))
+	p.Instance = r.URL.Path
+	WriteProblem(w, p)
+}
+
+// limitedBody records whether reading the request body failed because it exceeded its limit
+type limitedBody struct {
+	io.ReadCloser
+	exceeded atomic.Bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && errors.As(err, new(*http.MaxBytesError)) {
+		b.exceeded.Store(true)
+	}
+	return n, err
+}
+
+// bodyLimitWriter answers with 413 Request Entity Too Large instead of the handler response once the body exceeded its limit
+type bodyLimitWriter struct {
+	http.ResponseWriter
+	request     *http.Request
+	body        *limitedBody
+	limit       int64
+	wroteHeader bool
+	rejected    bool
+}
+
+func (w *bodyLimitWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if w.body.exceeded.Load() {
+		w.rejected = true
+		w.ResponseWriter.Header().Del("Content-Length")
+		writeBodyTooLarge(w.ResponseWriter, w.request, w.limit)
+		return
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *bodyLimitWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.rejected {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyLimitWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// finish writes the problem when the handler returned without writing a response after the body exceeded its limit
+func (w *bodyLimitWriter) finish() {
+	if !w.wroteHeader && w.body.exceeded.Load() {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+	}
+}
+
+// timeoutResponseWriter buffers the response of a handler running with a deadline, writes fail once the deadline has passed
+type timeoutResponseWriter struct {
+	header   http.Header
+	status   int
+	body     bytes.Buffer
+	timedOut bool
+	mux      sync.Mutex
+}
+
+func (w *timeoutResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *timeoutResponseWriter) WriteHeader(statusCode int) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.timedOut || w.status != 0 {
+		return
+	}
+	w.status = statusCode
+}
+
+func (w *timeoutResponseWriter) Write(b []byte) (int, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(b)
+}
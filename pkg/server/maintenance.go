@@ -0,0 +1,218 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+type MaintenanceOptions struct {
+	RetryAfter time.Duration
+	Page       []byte
+	// ContentType of Page, defaults to "text/html; charset=utf-8" when a Page is set without it
+	ContentType string
+	// AllowPaths are paths which are served normally during maintenance together with their subpaths,
+	// e.g. health and admin endpoints. "/health" allows "/health" and "/health/ready" but not "/healthz",
+	// "/" only allows the root path.
+	AllowPaths []string
+	// AllowNetworks are IP addresses or CIDR ranges of clients which are served normally during maintenance
+	AllowNetworks []string
+	// MarkerFile enables maintenance mode while the file exists, it is checked every PollInterval by Watch
+	MarkerFile   string
+	PollInterval time.Duration
+}
+
+func DefaultMaintenanceOptions() MaintenanceOptions {
+	return MaintenanceOptions{
+		RetryAfter:   5 * time.Minute,
+		Page:         []byte("Service is temporarily unavailable due to maintenance.\n"),
+		ContentType:  "text/plain; charset=utf-8",
+		PollInterval: 2 * time.Second,
+	}
+}
+
+func NewMaintenance(o MaintenanceOptions) (*Maintenance, error) {
+	if o.PollInterval <= 0 {
+		o.PollInterval = DefaultMaintenanceOptions().PollInterval
+	}
+	if len(o.Page) > 0 && o.ContentType == "" {
+		o.ContentType = "text/html; charset=utf-8"
+	}
+	m := &Maintenance{
+		options:  o,
+		networks: make([]*net.IPNet, 0, len(o.AllowNetworks)),
+	}
+
+	for _, n := range o.AllowNetworks {
+		if !strings.Contains(n, "/") {
+			if ip := net.ParseIP(n); ip != nil && ip.To4() != nil {
+				n += "/32"
+			} else {
+				n += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(n)
+		if err != nil {
+			return nil, fmt.Errorf("invalid maintenance network %q: %w", n, err)
+		}
+		m.networks = append(m.networks, network)
+	}
+	return m, nil
+}
+
+// Maintenance answers requests with 503 Service Unavailable while enabled, either manually or through the marker file
+type Maintenance struct {
+	options  MaintenanceOptions
+	networks []*net.IPNet
+	manual   atomic.Bool
+	marker   atomic.Bool
+}
+
+func (m *Maintenance) Enable() {
+	if !m.manual.Swap(true) {
+		slog.Info("maintenance mode enabled")
+	}
+}
+
+func (m *Maintenance) Disable() {
+	if m.manual.Swap(false) {
+		slog.Info("maintenance mode disabled")
+	}
+}
+
+func (m *Maintenance) Enabled() bool {
+	return m.manual.Load() || m.marker.Load()
+}
+
+// ReadinessCheck reports the service as not ready while maintenance mode is enabled
+func (m *Maintenance) ReadinessCheck(_ context.Context) error {
+	if m.Enabled() {
+		return ErrMaintenanceEnabled
+	}
+	return nil
+}
+
+func (m *Maintenance) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !m.Enabled() || m.allowed(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if m.options.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(m.options.RetryAfter.Seconds())))
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		if len(m.options.Page) == 0 {
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", m.options.ContentType)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write(m.options.Page)
+	})
+}
+
+// AdminHandler reports the maintenance state on GET, enables it on PUT or POST and disables it on DELETE
+func (m *Maintenance) AdminHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			m.Enable()
+		case http.MethodDelete:
+			m.Disable()
+		default:
+			w.Header().Set("Allow", "GET, PUT, POST, DELETE")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		writeJson(w, http.StatusOK, map[string]bool{
+			"enabled": m.Enabled(),
+			"manual":  m.manual.Load(),
+			"marker":  m.marker.Load(),
+		})
+	})
+}
+
+// Watch polls the marker file until ctx is cancelled
+func (m *Maintenance) Watch(ctx context.Context) {
+	if m.options.MarkerFile == "" {
+		return
+	}
+
+	ticker := time.NewTicker(m.options.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		_, err := os.Stat(m.options.MarkerFile)
+		exists := err == nil
+		if m.marker.Swap(exists) != exists {
+			slog.Info("maintenance marker file changed", "file", m.options.MarkerFile, "enabled", exists)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *Maintenance) allowed(r *http.Request) bool {
+	for _, p := range m.options.AllowPaths {
+		if allowedPath(r.URL.Path, p) {
+			return true
+		}
+	}
+
+	if len(m.networks) == 0 {
+		return false
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range m.networks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedPath reports whether path equals allow or is one of its subpaths, only whole segments are matched
+func allowedPath(path string, allow string) bool {
+	prefix := strings.TrimSuffix(allow, "/")
+	if prefix == "" {
+		return path == "/"
+	}
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
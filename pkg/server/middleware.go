@@ -0,0 +1,104 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package server
+
+import (
+	"bytes"
+	"net/http"
+)
+
+type Middleware func(next http.Handler) http.Handler
+
+// Chain wraps h with the middleware, the first middleware being the outermost handler
+func Chain(h http.Handler, m ...Middleware) http.Handler {
+	for i := len(m) - 1; i >= 0; i-- {
+		h = m[i](h)
+	}
+	return h
+}
+
+// RouteResolver is implemented by *http.ServeMux and is used to label requests with their matching route pattern
+type RouteResolver interface {
+	Handler(r *http.Request) (h http.Handler, pattern string)
+}
+
+// routeUnmatched labels requests without route pattern, request paths are never used as labels to keep their number bounded
+const routeUnmatched = "unmatched"
+
+func routeOf(h http.Handler, r *http.Request) string {
+	if resolver, ok := h.(RouteResolver); ok {
+		if _, pattern := resolver.Handler(r); pattern != "" {
+			return pattern
+		}
+	}
+	return routeUnmatched
+}
+
+// responseRecorder passes the response to the underlying writer while recording the status, size and optionally the body
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int64
+	body   *bytes.Buffer
+}
+
+func newResponseRecorder(w http.ResponseWriter, captureBody bool) *responseRecorder {
+	r := &responseRecorder{
+		ResponseWriter: w,
+	}
+	if captureBody {
+		r.body = &bytes.Buffer{}
+	}
+	return r
+}
+
+func (r *responseRecorder) WriteHeader(statusCode int) {
+	if r.status == 0 {
+		r.status = statusCode
+	}
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.size += int64(n)
+	if r.body != nil {
+		r.body.Write(b[:n])
+	}
+	return n, err
+}
+
+func (r *responseRecorder) Flush() {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	_ = http.NewResponseController(r.ResponseWriter).Flush()
+}
+
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+func (r *responseRecorder) Status() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
@@ -0,0 +1,212 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type OpenApiInfo struct {
+	Title       string `json:"title" yaml:"title"`
+	Version     string `json:"version" yaml:"version"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+}
+
+type OpenApiDocument struct {
+	OpenApi    string                                  `json:"openapi" yaml:"openapi"`
+	Info       OpenApiInfo                             `json:"info" yaml:"info"`
+	Paths      map[string]map[string]*OpenApiOperation `json:"paths" yaml:"paths"`
+	Components *OpenApiComponents                      `json:"components,omitempty" yaml:"components,omitempty"`
+}
+
+type OpenApiComponents struct {
+	Schemas map[string]*Schema `json:"schemas,omitempty" yaml:"schemas,omitempty"`
+}
+
+type OpenApiOperation struct {
+	OperationId string                      `json:"operationId,omitempty" yaml:"operationId,omitempty"`
+	Summary     string                      `json:"summary,omitempty" yaml:"summary,omitempty"`
+	Description string                      `json:"description,omitempty" yaml:"description,omitempty"`
+	Tags        []string                    `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Deprecated  bool                        `json:"deprecated,omitempty" yaml:"deprecated,omitempty"`
+	Parameters  []OpenApiParameter          `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+	RequestBody *OpenApiRequestBody         `json:"requestBody,omitempty" yaml:"requestBody,omitempty"`
+	Responses   map[string]*OpenApiResponse `json:"responses" yaml:"responses"`
+}
+
+type OpenApiParameter struct {
+	Name        string  `json:"name" yaml:"name"`
+	In          string  `json:"in" yaml:"in"`
+	Description string  `json:"description,omitempty" yaml:"description,omitempty"`
+	Required    bool    `json:"required,omitempty" yaml:"required,omitempty"`
+	Schema      *Schema `json:"schema" yaml:"schema"`
+}
+
+type OpenApiRequestBody struct {
+	Required bool                        `json:"required" yaml:"required"`
+	Content  map[string]OpenApiMediaType `json:"content" yaml:"content"`
+}
+
+type OpenApiResponse struct {
+	Description string                      `json:"description" yaml:"description"`
+	Content     map[string]OpenApiMediaType `json:"content,omitempty" yaml:"content,omitempty"`
+}
+
+type OpenApiMediaType struct {
+	Schema *Schema `json:"schema" yaml:"schema"`
+}
+
+var pathParameterRegex = regexp.MustCompile(`\{([^}]+)}`)
+
+// OpenApi generates an OpenAPI 3.1 document describing all registered routes
+func (r *Router) OpenApi(info OpenApiInfo) *OpenApiDocument {
+	g := newSchemaGenerator()
+	doc := &OpenApiDocument{
+		OpenApi: "3.1.0",
+		Info:    info,
+		Paths:   make(map[string]map[string]*OpenApiOperation),
+	}
+
+	for _, route := range r.Routes() {
+		path, pathParameters := openApiPath(route.Path)
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(map[string]*OpenApiOperation)
+		}
+		doc.Paths[path][strings.ToLower(route.Method)] = openApiOperation(g, route.Operation, pathParameters)
+	}
+
+	if len(g.components) > 0 {
+		doc.Components = &OpenApiComponents{Schemas: g.components}
+	}
+	return doc
+}
+
+// OpenApiHandler serves the OpenAPI document as JSON, or as YAML when requested through the Accept header or ?format=yaml
+func (r *Router) OpenApiHandler(info OpenApiInfo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		doc := r.OpenApi(info)
+
+		if req.URL.Query().Get("format") == "yaml" || strings.Contains(req.Header.Get("Accept"), "yaml") {
+			w.Header().Set("Content-Type", "application/yaml")
+			if err := yaml.NewEncoder(w).Encode(doc); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(doc); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// ServeOpenApi registers the OpenAPI document on path, the route itself is not included in the document
+func (r *Router) ServeOpenApi(path string, info OpenApiInfo) {
+	r.mux.Handle(http.MethodGet+" "+path, r.OpenApiHandler(info))
+}
+
+func openApiOperation(g *schemaGenerator, o Operation, pathParameters []string) *OpenApiOperation {
+	op := &OpenApiOperation{
+		OperationId: o.Id,
+		Summary:     o.Summary,
+		Description: o.Description,
+		Tags:        o.Tags,
+		Deprecated:  o.Deprecated,
+		Responses:   make(map[string]*OpenApiResponse),
+	}
+
+	declared := make(map[string]bool)
+	for _, p := range o.Parameters {
+		declared[p.In+":"+p.Name] = true
+		schema := &Schema{Type: "string"}
+		if p.Type != nil {
+			schema = g.schemaOf(p.Type)
+		}
+		op.Parameters = append(op.Parameters, OpenApiParameter{
+			Name:        p.Name,
+			In:          p.In,
+			Description: p.Description,
+			Required:    p.Required || p.In == "path",
+			Schema:      schema,
+		})
+	}
+	for _, name := range pathParameters {
+		if !declared["path:"+name] {
+			op.Parameters = append(op.Parameters, OpenApiParameter{
+				Name:     name,
+				In:       "path",
+				Required: true,
+				Schema:   &Schema{Type: "string"},
+			})
+		}
+	}
+
+	if o.Request != nil {
+		op.RequestBody = &OpenApiRequestBody{
+			Required: true,
+			Content: map[string]OpenApiMediaType{
+				"application/json": {Schema: g.schemaOf(o.Request)},
+			},
+		}
+	}
+
+	statusCodes := make([]int, 0, len(o.Responses))
+	for status := range o.Responses {
+		statusCodes = append(statusCodes, status)
+	}
+	sort.Ints(statusCodes)
+	for _, status := range statusCodes {
+		response := o.Responses[status]
+		description := response.Description
+		if description == "" {
+			description = http.StatusText(status)
+		}
+		r := &OpenApiResponse{Description: description}
+		if response.Body != nil {
+			r.Content = map[string]OpenApiMediaType{
+				"application/json": {Schema: g.schemaOf(response.Body)},
+			}
+		}
+		op.Responses[strconv.Itoa(status)] = r
+	}
+	if len(op.Responses) == 0 {
+		op.Responses["default"] = &OpenApiResponse{Description: "default response"}
+	}
+	return op
+}
+
+// openApiPath converts a http.ServeMux path pattern to an OpenAPI path and returns the names of the path parameters
+func openApiPath(pattern string) (string, []string) {
+	path := strings.TrimSuffix(pattern, "{$}")
+	names := make([]string, 0)
+	path = pathParameterRegex.ReplaceAllStringFunc(path, func(m string) string {
+		name := strings.TrimSuffix(strings.Trim(m, "{}"), "...")
+		names = append(names, name)
+		return "{" + name + "}"
+	})
+	return path, names
+}
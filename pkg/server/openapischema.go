@@ -0,0 +1,212 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package server
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema is a JSON Schema as used by OpenAPI 3.1
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty" yaml:"$ref,omitempty"`
+	Type                 any                `json:"type,omitempty" yaml:"type,omitempty"`
+	Format               string             `json:"format,omitempty" yaml:"format,omitempty"`
+	Description          string             `json:"description,omitempty" yaml:"description,omitempty"`
+	Enum                 []any              `json:"enum,omitempty" yaml:"enum,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty" yaml:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty" yaml:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty" yaml:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty" yaml:"additionalProperties,omitempty"`
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func newSchemaGenerator() *schemaGenerator {
+	return &schemaGenerator{
+		components: make(map[string]*Schema),
+		names:      make(map[reflect.Type]string),
+		types:      make(map[string]reflect.Type),
+	}
+}
+
+type schemaGenerator struct {
+	components map[string]*Schema
+	names      map[reflect.Type]string
+	types      map[string]reflect.Type
+}
+
+// schemaOf returns the schema for the type of v, named struct types are added to the components and referenced
+func (g *schemaGenerator) schemaOf(v any) *Schema {
+	if v == nil {
+		return nil
+	}
+	return g.schema(reflect.TypeOf(v))
+}
+
+func (g *schemaGenerator) schema(t reflect.Type) *Schema {
+	nullable := false
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+		nullable = true
+	}
+
+	var s *Schema
+	switch {
+	case t == timeType:
+		s = &Schema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.Struct:
+		s = g.structRef(t)
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		s = &Schema{Type: "string", Format: "byte"}
+	case t.Kind() == reflect.Slice, t.Kind() == reflect.Array:
+		s = &Schema{Type: "array", Items: g.schema(t.Elem())}
+	case t.Kind() == reflect.Map:
+		s = &Schema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case t.Kind() == reflect.Bool:
+		s = &Schema{Type: "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		s = &Schema{Type: "integer"}
+		if t.Kind() == reflect.Int64 || t.Kind() == reflect.Uint64 {
+			s.Format = "int64"
+		} else if t.Kind() == reflect.Int32 || t.Kind() == reflect.Uint32 {
+			s.Format = "int32"
+		}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		s = &Schema{Type: "number"}
+	case t.Kind() == reflect.String:
+		s = &Schema{Type: "string"}
+	default:
+		s = &Schema{}
+	}
+
+	if nullable && s.Ref == "" && s.Type != nil {
+		s.Type = []string{s.Type.(string), "null"}
+	}
+	return s
+}
+
+func (g *schemaGenerator) structRef(t reflect.Type) *Schema {
+	if t.Name() == "" {
+		return g.structSchema(t)
+	}
+
+	name := g.componentName(t)
+	if _, found := g.components[name]; !found {
+		// Register the name before generating the properties to support recursive types
+		g.components[name] = &Schema{}
+		*g.components[name] = *g.structSchema(t)
+	}
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// componentName returns a unique component name for t, the type name is qualified with its package path
+// when another type with the same name was registered before
+func (g *schemaGenerator) componentName(t reflect.Type) string {
+	if name, found := g.names[t]; found {
+		return name
+	}
+
+	name := sanitizeComponentName(t.Name())
+	if _, found := g.types[name]; found {
+		name = sanitizeComponentName(t.PkgPath() + "." + t.Name())
+	}
+	unique := name
+	for i := 2; ; i++ {
+		if _, found := g.types[unique]; !found {
+			break
+		}
+		unique = name + "_" + strconv.Itoa(i)
+	}
+
+	g.names[t] = unique
+	g.types[unique] = t
+	return unique
+}
+
+// sanitizeComponentName replaces all characters OpenAPI does not allow in component names,
+// such as the brackets and slashes in the names of generic types
+func sanitizeComponentName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+	return strings.Trim(name, "_")
+}
+
+func (g *schemaGenerator) structSchema(t reflect.Type) *Schema {
+	s := &Schema{
+		Type:       "object",
+		Properties: make(map[string]*Schema),
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		name, options, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+
+		// Promote the fields of embedded structs without a json name
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			embedded := g.structSchema(f.Type)
+			for k, v := range embedded.Properties {
+				s.Properties[k] = v
+			}
+			s.Required = append(s.Required, embedded.Required...)
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		property := g.schema(f.Type)
+		if description := f.Tag.Get("description"); description != "" {
+			if property.Ref != "" {
+				property = &Schema{Ref: property.Ref, Description: description}
+			} else {
+				property.Description = description
+			}
+		}
+		if enum := f.Tag.Get("enum"); enum != "" {
+			for _, e := range strings.Split(enum, ",") {
+				property.Enum = append(property.Enum, e)
+			}
+		}
+		if format := f.Tag.Get("format"); format != "" {
+			property.Format = format
+		}
+		s.Properties[name] = property
+
+		// Fields are required unless they are optional for encoding/json
+		if !strings.Contains(options, "omitempty") && f.Type.Kind() != reflect.Pointer {
+			s.Required = append(s.Required, name)
+		}
+	}
+	return s
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+package server
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/corelayer/go-kit/pkg/audit"
+)
+
+type schemaTestPage[T any] struct {
+	Items []T
+}
+
+// Record has the same name as audit.Record
+type Record struct {
+	Name string
+}
+
+func TestSchemaGenerator_ComponentNames(t *testing.T) {
+	g := newSchemaGenerator()
+	tests := []struct {
+		name string
+		v    any
+		ref  string
+	}{
+		{
+			name: "named struct",
+			v:    Record{},
+			ref:  "#/components/schemas/Record",
+		},
+		{
+			name: "same name in another package",
+			v:    audit.Record{},
+			ref:  "#/components/schemas/github.com_corelayer_go-kit_pkg_audit.Record",
+		},
+		{
+			name: "same type again",
+			v:    &Record{},
+			ref:  "#/components/schemas/Record",
+		},
+		{
+			name: "generic type",
+			v:    schemaTestPage[Record]{},
+			ref:  "#/components/schemas/schemaTestPage_github.com_corelayer_go-kit_pkg_server.Record",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := g.schemaOf(tt.v).Ref; got != tt.ref {
+				t.Errorf("schemaOf() ref = %q, want %q", got, tt.ref)
+			}
+		})
+	}
+
+	if len(g.components) != 3 {
+		t.Errorf("components = %d, want 3", len(g.components))
+	}
+	if g.types["Record"] != reflect.TypeOf(Record{}) {
+		t.Errorf("component Record = %v, want %v", g.types["Record"], reflect.TypeOf(Record{}))
+	}
+}
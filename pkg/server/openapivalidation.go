@@ -0,0 +1,328 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxValidationBodySize limits the request body size which is read to validate it against its schema
+const maxValidationBodySize = 10 << 20
+
+type requestValidator struct {
+	path       string
+	parameters []OpenApiParameter
+	body       *Schema
+	components map[string]*Schema
+}
+
+// ValidationMiddleware rejects requests which do not match the parameters and request body schema of their operation.
+// Routes must be registered through the router for their operation to be validated.
+// Validators are built once for all registered routes, routes registered later are added on their first request.
+func (r *Router) ValidationMiddleware(next http.Handler) http.Handler {
+	validators := &requestValidators{
+		validators: make(map[string]requestValidator),
+	}
+	for _, route := range r.Routes() {
+		validators.validators[route.Pattern()] = newRequestValidator(&route)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		route, found := r.route(req)
+		if !found {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		validator := validators.get(route)
+		problems, err := validator.validate(w, req)
+		if err != nil {
+			if errors.As(err, new(*http.MaxBytesError)) {
+				writeBodyTooLarge(w, req, maxValidationBodySize)
+				return
+			}
+			writeValidationProblem(w, req, err.Error())
+			return
+		}
+		if len(problems) > 0 {
+			writeValidationProblem(w, req, strings.Join(problems, "; "))
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+func writeValidationProblem(w http.ResponseWriter, r *http.Request, detail string) {
+	p := NewProblem(http.StatusBadRequest, detail)
+	p.Instance = r.URL.Path
+	WriteProblem(w, p)
+}
+
+type requestValidators struct {
+	validators map[string]requestValidator
+	mux        sync.RWMutex
+}
+
+func (v *requestValidators) get(route *Route) requestValidator {
+	pattern := route.Pattern()
+
+	v.mux.RLock()
+	validator, found := v.validators[pattern]
+	v.mux.RUnlock()
+	if found {
+		return validator
+	}
+
+	validator = newRequestValidator(route)
+	v.mux.Lock()
+	v.validators[pattern] = validator
+	v.mux.Unlock()
+	return validator
+}
+
+func newRequestValidator(route *Route) requestValidator {
+	g := newSchemaGenerator()
+	_, pathParameters := openApiPath(route.Path)
+	op := openApiOperation(g, route.Operation, pathParameters)
+
+	v := requestValidator{
+		path:       route.Path,
+		parameters: op.Parameters,
+		components: g.components,
+	}
+	if op.RequestBody != nil {
+		v.body = op.RequestBody.Content["application/json"].Schema
+	}
+	return v
+}
+
+func (v requestValidator) validate(w http.ResponseWriter, r *http.Request) ([]string, error) {
+	problems := make([]string, 0)
+
+	// Path values are only available on the request once the mux has dispatched it, extract them from the pattern
+	pathValues := matchPathValues(v.path, r.URL.Path)
+
+	for _, p := range v.parameters {
+		var (
+			value   string
+			present bool
+		)
+		switch p.In {
+		case "path":
+			value, present = pathValues[p.Name]
+		case "query":
+			present = r.URL.Query().Has(p.Name)
+			value = r.URL.Query().Get(p.Name)
+		case "header":
+			value = r.Header.Get(p.Name)
+			present = value != ""
+		case "cookie":
+			if c, err := r.Cookie(p.Name); err == nil {
+				value, present = c.Value, true
+			}
+		}
+
+		if !present {
+			if p.Required {
+				problems = append(problems, fmt.Sprintf("%s parameter %q is required", p.In, p.Name))
+			}
+			continue
+		}
+		if !validParameter(value, p.Schema) {
+			problems = append(problems, fmt.Sprintf("%s parameter %q must be of type %v", p.In, p.Name, p.Schema.Type))
+		}
+	}
+
+	if v.body == nil {
+		return problems, nil
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxValidationBodySize))
+	if err != nil {
+		return nil, err
+	}
+	_ = r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	var value any
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err = decoder.Decode(&value); err != nil {
+		return append(problems, "request body is not valid json: "+err.Error()), nil
+	}
+	return append(problems, v.validateValue(value, v.body, "body")...), nil
+}
+
+func (v requestValidator) validateValue(value any, s *Schema, path string) []string {
+	if s == nil {
+		return nil
+	}
+	if s.Ref != "" {
+		return v.validateValue(value, v.components[strings.TrimPrefix(s.Ref, "#/components/schemas/")], path)
+	}
+
+	types := schemaTypes(s)
+	if len(types) == 0 {
+		return nil
+	}
+
+	matched := ""
+	for _, t := range types {
+		if matchesType(value, t) {
+			matched = t
+			break
+		}
+	}
+	if matched == "" {
+		return []string{fmt.Sprintf("%s must be of type %s", path, strings.Join(types, " or "))}
+	}
+
+	problems := make([]string, 0)
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if fmt.Sprint(e) == fmt.Sprint(value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("%s must be one of %v", path, s.Enum))
+		}
+	}
+
+	switch matched {
+	case "object":
+		object := value.(map[string]any)
+		for _, name := range s.Required {
+			if _, found := object[name]; !found {
+				problems = append(problems, fmt.Sprintf("%s.%s is required", path, name))
+			}
+		}
+		for name, property := range object {
+			if ps, found := s.Properties[name]; found {
+				problems = append(problems, v.validateValue(property, ps, path+"."+name)...)
+			} else if s.AdditionalProperties != nil {
+				problems = append(problems, v.validateValue(property, s.AdditionalProperties, path+"."+name)...)
+			}
+		}
+	case "array":
+		for i, item := range value.([]any) {
+			problems = append(problems, v.validateValue(item, s.Items, path+"["+strconv.Itoa(i)+"]")...)
+		}
+	}
+	return problems
+}
+
+func schemaTypes(s *Schema) []string {
+	switch t := s.Type.(type) {
+	case string:
+		return []string{t}
+	case []string:
+		return t
+	default:
+		return nil
+	}
+}
+
+func matchesType(value any, t string) bool {
+	switch t {
+	case "null":
+		return value == nil
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "number":
+		_, ok := value.(json.Number)
+		return ok
+	case "integer":
+		n, ok := value.(json.Number)
+		if !ok {
+			return false
+		}
+		f, err := n.Float64()
+		return err == nil && f == math.Trunc(f)
+	default:
+		return true
+	}
+}
+
+func validParameter(value string, s *Schema) bool {
+	for _, t := range schemaTypes(s) {
+		switch t {
+		case "integer":
+			if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+				return true
+			}
+		case "number":
+			if _, err := strconv.ParseFloat(value, 64); err == nil {
+				return true
+			}
+		case "boolean":
+			if _, err := strconv.ParseBool(value); err == nil {
+				return true
+			}
+		default:
+			return true
+		}
+	}
+	return len(schemaTypes(s)) == 0
+}
+
+func matchPathValues(pattern string, path string) map[string]string {
+	values := make(map[string]string)
+
+	// Strip the host from patterns like "example.com/items/{id}"
+	if i := strings.Index(pattern, "/"); i > 0 {
+		pattern = pattern[i:]
+	}
+
+	patternSegments := strings.Split(strings.Trim(pattern, "/"), "/")
+	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, segment := range patternSegments {
+		if !strings.HasPrefix(segment, "{") || !strings.HasSuffix(segment, "}") || i >= len(pathSegments) {
+			continue
+		}
+		name := strings.Trim(segment, "{}")
+		if rest, found := strings.CutSuffix(name, "..."); found {
+			values[rest] = strings.Join(pathSegments[i:], "/")
+			break
+		}
+		if name != "$" {
+			values[name] = pathSegments[i]
+		}
+	}
+	return values
+}
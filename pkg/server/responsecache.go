@@ -0,0 +1,474 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type ResponseCacheOptions struct {
+	// WeakEtags generates weak validators instead of strong ones
+	WeakEtags bool
+	// Store enables caching of full responses in memory, only conditional requests are handled otherwise
+	Store bool
+	// Ttl is used for responses which do not specify a max-age, responses without max-age are not stored when zero
+	Ttl time.Duration
+	// MaxEntries limits the number of responses in the cache
+	MaxEntries int
+	// MaxEntrySize limits the size of a single response body, larger responses are streamed and not stored
+	MaxEntrySize int64
+	// MaxSize limits the total size of all cached response bodies
+	MaxSize int64
+}
+
+func DefaultResponseCacheOptions() ResponseCacheOptions {
+	return ResponseCacheOptions{
+		Store:        true,
+		MaxEntries:   1000,
+		MaxEntrySize: 1 << 20,
+		MaxSize:      64 << 20,
+	}
+}
+
+func NewResponseCache(o ResponseCacheOptions) *ResponseCache {
+	return &ResponseCache{
+		options: o,
+		entries: make(map[string]*list.Element),
+		varies:  make(map[string]*cachedVariants),
+		lru:     list.New(),
+	}
+}
+
+// ResponseCache answers conditional requests using ETag and Last-Modified validators, and optionally caches full
+// responses in memory keyed by method, path and the request headers listed in Vary.
+type ResponseCache struct {
+	options ResponseCacheOptions
+	entries map[string]*list.Element
+	varies  map[string]*cachedVariants
+	lru     *list.List
+	size    int64
+	mux     sync.Mutex
+}
+
+// cachedVariants holds the Vary headers of a primary key and the number of variants stored for it
+type cachedVariants struct {
+	headers []string
+	count   int
+}
+
+type cachedResponse struct {
+	primary string
+	key     string
+	status  int
+	header  http.Header
+	body    []byte
+	stored  time.Time
+	expires time.Time
+}
+
+func (c *ResponseCache) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			c.invalidate(r)
+			return
+		}
+
+		requestDirectives := parseCacheControl(r.Header.Get("Cache-Control"))
+		_, noCache := requestDirectives["no-cache"]
+		_, noStore := requestDirectives["no-store"]
+
+		if c.options.Store && !noCache {
+			if entry, found := c.lookup(r); found {
+				w.Header().Set("Age", strconv.Itoa(int(time.Since(entry.stored).Seconds())))
+				w.Header().Set("X-Cache", "HIT")
+				c.write(w, r, entry.status, entry.header, entry.body)
+				return
+			}
+		}
+
+		bw := &bufferedResponseWriter{
+			ResponseWriter: w,
+			header:         make(http.Header),
+			limit:          c.options.MaxEntrySize,
+		}
+		next.ServeHTTP(bw, r)
+		if bw.passthrough {
+			return
+		}
+
+		status := bw.Status()
+		if status == http.StatusOK && bw.header.Get("ETag") == "" {
+			bw.header.Set("ETag", c.etag(bw.body.Bytes()))
+		}
+
+		if c.options.Store && !noStore {
+			c.store(r, status, bw.header, bw.body.Bytes())
+			w.Header().Set("X-Cache", "MISS")
+		}
+		c.write(w, r, status, bw.header, bw.body.Bytes())
+	})
+}
+
+// Purge removes all responses from the cache
+func (c *ResponseCache) Purge() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.entries = make(map[string]*list.Element)
+	c.varies = make(map[string]*cachedVariants)
+	c.lru.Init()
+	c.size = 0
+}
+
+func (c *ResponseCache) write(w http.ResponseWriter, r *http.Request, status int, header http.Header, body []byte) {
+	for k, v := range header {
+		w.Header()[k] = v
+	}
+
+	if status == http.StatusOK && notModified(r, header) {
+		for _, k := range []string{"Content-Type", "Content-Length", "Content-Encoding"} {
+			w.Header().Del(k)
+		}
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(body)
+	}
+}
+
+func (c *ResponseCache) etag(body []byte) string {
+	sum := sha256.Sum256(body)
+	tag := `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+	if c.options.WeakEtags {
+		return "W/" + tag
+	}
+	return tag
+}
+
+func (c *ResponseCache) lookup(r *http.Request) (*cachedResponse, bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	primary := cachePrimaryKey(r)
+	variants, found := c.varies[primary]
+	if !found {
+		return nil, false
+	}
+	element, found := c.entries[cacheVariantKey(primary, variants.headers, r)]
+	if !found {
+		return nil, false
+	}
+
+	entry := element.Value.(*cachedResponse)
+	if time.Now().After(entry.expires) {
+		c.remove(element)
+		return nil, false
+	}
+	c.lru.MoveToFront(element)
+	return entry, true
+}
+
+func (c *ResponseCache) store(r *http.Request, status int, header http.Header, body []byte) {
+	// Only GET responses are stored, HEAD requests are answered from them but never populate the cache
+	if r.Method != http.MethodGet || status != http.StatusOK || header.Get("Set-Cookie") != "" {
+		return
+	}
+	if c.options.MaxEntrySize > 0 && int64(len(body)) > c.options.MaxEntrySize {
+		return
+	}
+
+	directives := parseCacheControl(header.Get("Cache-Control"))
+	for _, d := range []string{"no-store", "no-cache", "private"} {
+		if _, found := directives[d]; found {
+			return
+		}
+	}
+	if r.Header.Get("Authorization") != "" && !sharedCacheable(directives) {
+		return
+	}
+
+	ttl := c.options.Ttl
+	if value := header.Get("Expires"); value != "" {
+		// An invalid date, such as "0", means the response has already expired
+		ttl = 0
+		if expires, err := http.ParseTime(value); err == nil {
+			ttl = time.Until(expires)
+		}
+	}
+	for _, d := range []string{"max-age", "s-maxage"} {
+		if value, found := directives[d]; found {
+			if seconds, err := strconv.Atoi(value); err == nil {
+				ttl = time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	vary := headerTokens(header, "Vary")
+	for i, v := range vary {
+		if v == "*" {
+			return
+		}
+		vary[i] = http.CanonicalHeaderKey(v)
+	}
+	sort.Strings(vary)
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	primary := cachePrimaryKey(r)
+	entry := &cachedResponse{
+		primary: primary,
+		key:     cacheVariantKey(primary, vary, r),
+		status:  status,
+		header:  header.Clone(),
+		body:    bytes.Clone(body),
+		stored:  time.Now(),
+		expires: time.Now().Add(ttl),
+	}
+
+	// Variants stored under different Vary headers can no longer be looked up
+	if variants, found := c.varies[primary]; found && !slices.Equal(variants.headers, vary) {
+		c.removePrimary(primary)
+	}
+	if element, found := c.entries[entry.key]; found {
+		c.remove(element)
+	}
+	variants, found := c.varies[primary]
+	if !found {
+		variants = &cachedVariants{}
+		c.varies[primary] = variants
+	}
+	variants.headers = vary
+	variants.count++
+	c.entries[entry.key] = c.lru.PushFront(entry)
+	c.size += int64(len(entry.body))
+
+	for c.lru.Len() > 0 && ((c.options.MaxEntries > 0 && c.lru.Len() > c.options.MaxEntries) || (c.options.MaxSize > 0 && c.size > c.options.MaxSize)) {
+		c.remove(c.lru.Back())
+	}
+}
+
+// invalidate removes all cached variants for the target of an unsafe request
+func (c *ResponseCache) invalidate(r *http.Request) {
+	if !c.options.Store {
+		return
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.removePrimary(cachePrimaryKey(r))
+}
+
+// removePrimary removes all variants stored for a primary key, the caller must hold the lock
+func (c *ResponseCache) removePrimary(primary string) {
+	for key, element := range c.entries {
+		if key == primary || strings.HasPrefix(key, primary+"\n") {
+			c.remove(element)
+		}
+	}
+	delete(c.varies, primary)
+}
+
+func (c *ResponseCache) remove(element *list.Element) {
+	entry := c.lru.Remove(element).(*cachedResponse)
+	delete(c.entries, entry.key)
+	c.size -= int64(len(entry.body))
+
+	// Forget the Vary headers of a primary key once its last variant is gone
+	if variants, found := c.varies[entry.primary]; found {
+		if variants.count--; variants.count <= 0 {
+			delete(c.varies, entry.primary)
+		}
+	}
+}
+
+// sharedCacheable reports whether a response to an authorized request may be stored (RFC 9111 section 3.5)
+func sharedCacheable(directives map[string]string) bool {
+	for _, d := range []string{"public", "s-maxage", "must-revalidate"} {
+		if _, found := directives[d]; found {
+			return true
+		}
+	}
+	return false
+}
+
+func cachePrimaryKey(r *http.Request) string {
+	// HEAD requests are answered from cached GET responses
+	return http.MethodGet + " " + r.Host + r.URL.RequestURI()
+}
+
+func cacheVariantKey(primary string, vary []string, r *http.Request) string {
+	if len(vary) == 0 {
+		return primary
+	}
+	var b strings.Builder
+	b.WriteString(primary)
+	for _, name := range vary {
+		b.WriteString("\n" + name + ":" + strings.Join(r.Header.Values(name), ","))
+	}
+	return b.String()
+}
+
+func notModified(r *http.Request, header http.Header) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		etag := strings.TrimPrefix(header.Get("ETag"), "W/")
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		modifiedSince, err := http.ParseTime(ims)
+		if err != nil {
+			return false
+		}
+		lastModified, err := http.ParseTime(header.Get("Last-Modified"))
+		if err != nil {
+			return false
+		}
+		return !lastModified.Truncate(time.Second).After(modifiedSince)
+	}
+	return false
+}
+
+func parseCacheControl(value string) map[string]string {
+	directives := make(map[string]string)
+	for _, d := range strings.Split(value, ",") {
+		name, v, _ := strings.Cut(strings.TrimSpace(d), "=")
+		if name != "" {
+			directives[strings.ToLower(name)] = strings.Trim(v, `"`)
+		}
+	}
+	return directives
+}
+
+// bufferedResponseWriter holds the response in memory until the handler completes.
+// When the handler flushes or the body exceeds limit, the response is passed through unmodified.
+type bufferedResponseWriter struct {
+	http.ResponseWriter
+	header      http.Header
+	status      int
+	body        bytes.Buffer
+	limit       int64
+	passthrough bool
+}
+
+func (w *bufferedResponseWriter) Header() http.Header {
+	if w.passthrough {
+		return w.ResponseWriter.Header()
+	}
+	return w.header
+}
+
+func (w *bufferedResponseWriter) WriteHeader(statusCode int) {
+	if w.passthrough {
+		w.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	if w.status == 0 {
+		w.status = statusCode
+	}
+}
+
+func (w *bufferedResponseWriter) Write(b []byte) (int, error) {
+	if w.passthrough {
+		return w.ResponseWriter.Write(b)
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.limit > 0 && int64(w.body.Len()+len(b)) > w.limit {
+		w.startPassthrough()
+		return w.ResponseWriter.Write(b)
+	}
+	return w.body.Write(b)
+}
+
+func (w *bufferedResponseWriter) Flush() {
+	if !w.passthrough {
+		w.startPassthrough()
+	}
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Hijack hands the connection to the handler, the cache does not write a response afterwards
+func (w *bufferedResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil {
+		w.passthrough = true
+	}
+	return conn, brw, err
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer, e.g. to set deadlines.
+// Writes and flushes are handled by bufferedResponseWriter itself, so the response remains buffered.
+func (w *bufferedResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *bufferedResponseWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *bufferedResponseWriter) startPassthrough() {
+	if w.passthrough {
+		return
+	}
+	w.passthrough = true
+	for k, v := range w.header {
+		w.ResponseWriter.Header()[k] = v
+	}
+
+	// Nothing was written yet, let the handler write the status code itself
+	if w.status == 0 {
+		return
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	_, _ = w.ResponseWriter.Write(w.body.Bytes())
+	w.body.Reset()
+}
@@ -0,0 +1,244 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestResponseCache_Middleware(t *testing.T) {
+	tests := []struct {
+		name          string
+		cacheControl  string
+		expires       string
+		first         *http.Request
+		second        *http.Request
+		handlerCalls  int
+		secondXCache  string
+		secondBodyLen int
+	}{
+		{
+			name:          "get response is stored",
+			cacheControl:  "max-age=60",
+			first:         httptest.NewRequest(http.MethodGet, "/resource", nil),
+			second:        httptest.NewRequest(http.MethodGet, "/resource", nil),
+			handlerCalls:  1,
+			secondXCache:  "HIT",
+			secondBodyLen: 5,
+		},
+		{
+			name:          "head response is not stored",
+			cacheControl:  "max-age=60",
+			first:         httptest.NewRequest(http.MethodHead, "/resource", nil),
+			second:        httptest.NewRequest(http.MethodGet, "/resource", nil),
+			handlerCalls:  2,
+			secondXCache:  "MISS",
+			secondBodyLen: 5,
+		},
+		{
+			name:          "head request is answered from stored get response",
+			cacheControl:  "max-age=60",
+			first:         httptest.NewRequest(http.MethodGet, "/resource", nil),
+			second:        httptest.NewRequest(http.MethodHead, "/resource", nil),
+			handlerCalls:  1,
+			secondXCache:  "HIT",
+			secondBodyLen: 0,
+		},
+		{
+			name:          "authorized response is not stored",
+			cacheControl:  "max-age=60",
+			first:         authorizedRequest(http.MethodGet, "/resource"),
+			second:        authorizedRequest(http.MethodGet, "/resource"),
+			handlerCalls:  2,
+			secondXCache:  "MISS",
+			secondBodyLen: 5,
+		},
+		{
+			name:          "authorized public response is stored",
+			cacheControl:  "public, max-age=60",
+			first:         authorizedRequest(http.MethodGet, "/resource"),
+			second:        authorizedRequest(http.MethodGet, "/resource"),
+			handlerCalls:  1,
+			secondXCache:  "HIT",
+			secondBodyLen: 5,
+		},
+		{
+			name:          "response with future expires is stored",
+			expires:       time.Now().Add(time.Minute).UTC().Format(http.TimeFormat),
+			first:         httptest.NewRequest(http.MethodGet, "/resource", nil),
+			second:        httptest.NewRequest(http.MethodGet, "/resource", nil),
+			handlerCalls:  1,
+			secondXCache:  "HIT",
+			secondBodyLen: 5,
+		},
+		{
+			name:          "max-age takes precedence over expires",
+			cacheControl:  "max-age=60",
+			expires:       "0",
+			first:         httptest.NewRequest(http.MethodGet, "/resource", nil),
+			second:        httptest.NewRequest(http.MethodGet, "/resource", nil),
+			handlerCalls:  1,
+			secondXCache:  "HIT",
+			secondBodyLen: 5,
+		},
+		{
+			name:          "response with past expires is not stored",
+			expires:       time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat),
+			first:         httptest.NewRequest(http.MethodGet, "/resource", nil),
+			second:        httptest.NewRequest(http.MethodGet, "/resource", nil),
+			handlerCalls:  2,
+			secondXCache:  "MISS",
+			secondBodyLen: 5,
+		},
+		{
+			name:          "private response is not stored",
+			cacheControl:  "private, max-age=60",
+			first:         httptest.NewRequest(http.MethodGet, "/resource", nil),
+			second:        httptest.NewRequest(http.MethodGet, "/resource", nil),
+			handlerCalls:  2,
+			secondXCache:  "MISS",
+			secondBodyLen: 5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			handler := NewResponseCache(DefaultResponseCacheOptions()).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				w.Header().Set("Cache-Control", tt.cacheControl)
+				if tt.expires != "" {
+					w.Header().Set("Expires", tt.expires)
+				}
+				_, _ = w.Write([]byte("hello"))
+			}))
+
+			handler.ServeHTTP(httptest.NewRecorder(), tt.first)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, tt.second)
+
+			if calls != tt.handlerCalls {
+				t.Errorf("handler calls = %d, want %d", calls, tt.handlerCalls)
+			}
+			if got := w.Header().Get("X-Cache"); got != tt.secondXCache {
+				t.Errorf("X-Cache = %q, want %q", got, tt.secondXCache)
+			}
+			if got := w.Body.Len(); got != tt.secondBodyLen {
+				t.Errorf("body length = %d, want %d", got, tt.secondBodyLen)
+			}
+		})
+	}
+}
+
+func TestResponseCache_NotModified(t *testing.T) {
+	handler := NewResponseCache(DefaultResponseCacheOptions()).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = w.Write([]byte("hello"))
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/resource", nil))
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("missing ETag")
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/resource", nil)
+	r.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNotModified)
+	}
+}
+
+func TestResponseCache_EvictionPrunesVaries(t *testing.T) {
+	o := DefaultResponseCacheOptions()
+	o.MaxEntries = 2
+	c := NewResponseCache(o)
+	handler := c.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Language")
+		_, _ = w.Write([]byte(r.URL.Path))
+	}))
+
+	for i := 0; i < 10; i++ {
+		r := httptest.NewRequest(http.MethodGet, "/resource/"+strconv.Itoa(i), nil)
+		r.Header.Set("Accept-Language", "en")
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	if got := c.lru.Len(); got != 2 {
+		t.Errorf("entries = %d, want 2", got)
+	}
+	if got := len(c.varies); got != 2 {
+		t.Errorf("varies = %d, want 2", got)
+	}
+}
+
+func TestResponseCache_VaryChangeRemovesVariants(t *testing.T) {
+	c := NewResponseCache(DefaultResponseCacheOptions())
+	vary := "Accept-Language"
+	handler := c.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", vary)
+		_, _ = w.Write([]byte("hello"))
+	}))
+
+	for _, language := range []string{"en", "nl"} {
+		r := httptest.NewRequest(http.MethodGet, "/resource", nil)
+		r.Header.Set("Accept-Language", language)
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	vary = "Accept-Encoding"
+	r := httptest.NewRequest(http.MethodGet, "/resource", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	if got := c.lru.Len(); got != 1 {
+		t.Errorf("entries = %d, want 1", got)
+	}
+	if got := c.varies["GET example.com/resource"].count; got != 1 {
+		t.Errorf("variants = %d, want 1", got)
+	}
+}
+
+func TestResponseCache_ResponseControllerKeepsBuffering(t *testing.T) {
+	handler := NewResponseCache(DefaultResponseCacheOptions()).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Setting a deadline unwraps the writer, which must not bypass the cache
+		_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(time.Minute))
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = w.Write([]byte("hello"))
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/resource", nil))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/resource", nil))
+	if got := w.Header().Get("X-Cache"); got != "HIT" {
+		t.Errorf("X-Cache = %q, want %q", got, "HIT")
+	}
+}
+
+func authorizedRequest(method string, target string) *http.Request {
+	r := httptest.NewRequest(method, target, nil)
+	r.Header.Set("Authorization", "Bearer token")
+	return r
+}
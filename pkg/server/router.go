@@ -0,0 +1,128 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package server
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+)
+
+func NewRouter() *Router {
+	return &Router{
+		mux:    http.NewServeMux(),
+		routes: make(map[string]*Route),
+	}
+}
+
+// Router registers handlers on a http.ServeMux together with the operation metadata used to generate an OpenAPI document
+type Router struct {
+	mux    *http.ServeMux
+	routes map[string]*Route
+	order  []string
+	mu     sync.RWMutex
+}
+
+type Route struct {
+	Method    string
+	Path      string
+	Handler   http.Handler
+	Operation Operation
+}
+
+func (r Route) Pattern() string {
+	return r.Method + " " + r.Path
+}
+
+type Operation struct {
+	Id          string
+	Summary     string
+	Description string
+	Tags        []string
+	Deprecated  bool
+	Parameters  []Parameter
+	// Request is a value of the type expected in the JSON request body, nil when the operation has no body
+	Request any
+	// Responses maps status codes to the response returned by the operation
+	Responses map[int]Response
+}
+
+type Parameter struct {
+	Name        string
+	In          string
+	Description string
+	Required    bool
+	// Type is a value of the parameter type, parameters are considered strings when nil
+	Type any
+}
+
+type Response struct {
+	Description string
+	// Body is a value of the type returned in the JSON response body, nil when the response has no body
+	Body any
+}
+
+// Handle registers h for the method and path, the path uses the http.ServeMux pattern syntax, e.g. "/items/{id}"
+func (r *Router) Handle(method string, path string, h http.Handler, o Operation) {
+	route := &Route{
+		Method:    strings.ToUpper(method),
+		Path:      path,
+		Handler:   h,
+		Operation: o,
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.mux.Handle(route.Pattern(), h)
+	r.routes[route.Pattern()] = route
+	r.order = append(r.order, route.Pattern())
+}
+
+func (r *Router) HandleFunc(method string, path string, h http.HandlerFunc, o Operation) {
+	r.Handle(method, path, h, o)
+}
+
+// Routes returns all registered routes in registration order
+func (r *Router) Routes() []Route {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	output := make([]Route, 0, len(r.order))
+	for _, pattern := range r.order {
+		output = append(output, *r.routes[pattern])
+	}
+	return output
+}
+
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mux.ServeHTTP(w, req)
+}
+
+// Handler implements RouteResolver
+func (r *Router) Handler(req *http.Request) (http.Handler, string) {
+	return r.mux.Handler(req)
+}
+
+func (r *Router) route(req *http.Request) (*Route, bool) {
+	_, pattern := r.mux.Handler(req)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	route, found := r.routes[pattern]
+	return route, found
+}
@@ -0,0 +1,368 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxSessionCookieSize is the size browsers are required to support for the name and value of a single cookie
+const maxSessionCookieSize = 4096
+
+type SessionOptions struct {
+	Name     string
+	Path     string
+	Domain   string
+	MaxAge   time.Duration
+	Secure   bool
+	HttpOnly bool
+	SameSite http.SameSite
+}
+
+func DefaultSessionOptions() SessionOptions {
+	return SessionOptions{
+		Name:     "session",
+		Path:     "/",
+		MaxAge:   24 * time.Hour,
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// NewSessionManager creates a session manager storing sessions in store, the cookie then only holds the signed session id.
+// When store is nil, the session data is kept in the cookie itself.
+func NewSessionManager(codec *SessionCodec, store SessionStore, o SessionOptions) *SessionManager {
+	return &SessionManager{
+		codec:   codec,
+		store:   store,
+		options: o,
+	}
+}
+
+type SessionManager struct {
+	codec   *SessionCodec
+	store   SessionStore
+	options SessionOptions
+}
+
+type sessionContextKey struct{}
+
+// GetSession returns the session loaded by SessionManager.Middleware, or nil when the middleware is not in use
+func GetSession(ctx context.Context) *Session {
+	s, _ := ctx.Value(sessionContextKey{}).(*Session)
+	return s
+}
+
+func (m *SessionManager) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session := m.load(r)
+		sw := &beforeWriteResponseWriter{
+			ResponseWriter: w,
+			before: func(w http.ResponseWriter) {
+				if err := m.save(r.Context(), w, session); err != nil {
+					slog.Error("could not save session", "error", err)
+				}
+			},
+		}
+		next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), sessionContextKey{}, session)))
+		sw.trigger()
+	})
+}
+
+func (m *SessionManager) load(r *http.Request) *Session {
+	var (
+		err    error
+		cookie *http.Cookie
+		value  []byte
+	)
+
+	if cookie, err = r.Cookie(m.options.Name); err != nil {
+		return newSession()
+	}
+	if value, err = m.codec.Decode(m.options.Name, cookie.Value, m.options.MaxAge); err != nil {
+		return newSession()
+	}
+
+	session := &Session{values: make(map[string]any)}
+	if m.store == nil {
+		if err = session.unmarshal(value); err != nil {
+			return newSession()
+		}
+		return session
+	}
+
+	session.id = string(value)
+	if value, err = m.store.Load(r.Context(), session.id); err != nil {
+		if !errors.Is(err, ErrSessionNotFound) {
+			slog.Error("could not load session", "error", err)
+		}
+		return newSession()
+	}
+	if err = session.unmarshal(value); err != nil {
+		return newSession()
+	}
+	return session
+}
+
+func (m *SessionManager) save(ctx context.Context, w http.ResponseWriter, s *Session) error {
+	var (
+		err   error
+		data  []byte
+		value string
+	)
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	// The cookie is part of the response headers, later changes can no longer be sent to the client
+	s.committed = true
+
+	if s.destroyed {
+		if m.store != nil && s.id != "" {
+			if err = m.store.Delete(ctx, s.id); err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, m.cookie("", -1))
+		return nil
+	}
+
+	if !s.modified {
+		return nil
+	}
+
+	if data, err = s.marshal(); err != nil {
+		return err
+	}
+
+	if m.store == nil {
+		if value, err = m.codec.Encode(m.options.Name, data); err != nil {
+			return err
+		}
+		// Browsers silently drop oversized cookies, which would lose the session without any error
+		if len(m.options.Name)+len(value) > maxSessionCookieSize {
+			return fmt.Errorf("%w: %d bytes", ErrSessionTooLarge, len(m.options.Name)+len(value))
+		}
+	} else {
+		if s.previousId != "" {
+			if err = m.store.Delete(ctx, s.previousId); err != nil {
+				return err
+			}
+		}
+		if s.id == "" {
+			s.id = newSessionId()
+		}
+		if err = m.store.Save(ctx, s.id, data, m.options.MaxAge); err != nil {
+			return err
+		}
+		value, err = m.codec.Encode(m.options.Name, []byte(s.id))
+	}
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, m.cookie(value, int(m.options.MaxAge.Seconds())))
+	return nil
+}
+
+func (m *SessionManager) cookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     m.options.Name,
+		Value:    value,
+		Path:     m.options.Path,
+		Domain:   m.options.Domain,
+		MaxAge:   maxAge,
+		Secure:   m.options.Secure,
+		HttpOnly: m.options.HttpOnly,
+		SameSite: m.options.SameSite,
+	}
+}
+
+func newSession() *Session {
+	return &Session{
+		values: make(map[string]any),
+		isNew:  true,
+	}
+}
+
+func newSessionId() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+type Session struct {
+	id         string
+	previousId string
+	values     map[string]any
+	flashes    []string
+	isNew      bool
+	modified   bool
+	destroyed  bool
+	committed  bool
+	mux        sync.Mutex
+}
+
+type sessionData struct {
+	Values  map[string]any `json:"values,omitempty"`
+	Flashes []string       `json:"flashes,omitempty"`
+}
+
+func (s *Session) IsNew() bool {
+	return s.isNew
+}
+
+func (s *Session) Get(key string) (any, bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	v, found := s.values[key]
+	return v, found
+}
+
+func (s *Session) GetString(key string) string {
+	v, _ := s.Get(key)
+	output, _ := v.(string)
+	return output
+}
+
+// Set stores a value in the session, values must be serializable to JSON
+func (s *Session) Set(key string, value any) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.values[key] = value
+	s.modify()
+}
+
+func (s *Session) Delete(key string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	delete(s.values, key)
+	s.modify()
+}
+
+func (s *Session) AddFlash(message string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.flashes = append(s.flashes, message)
+	s.modify()
+}
+
+// Flashes returns and removes all flash messages from the session
+func (s *Session) Flashes() []string {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	flashes := s.flashes
+	if len(flashes) > 0 {
+		s.flashes = nil
+		s.modify()
+	}
+	return flashes
+}
+
+// Regenerate assigns a new session id while keeping the session data, this should be called after authentication
+func (s *Session) Regenerate() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.id != "" && s.previousId == "" {
+		s.previousId = s.id
+	}
+	s.id = newSessionId()
+	s.modify()
+}
+
+func (s *Session) Destroy() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.values = make(map[string]any)
+	s.flashes = nil
+	s.destroyed = true
+	s.modify()
+}
+
+// modify marks the session for saving, it must be called with the lock held
+func (s *Session) modify() {
+	s.modified = true
+	if s.committed {
+		slog.Warn("session modified after the response headers were written, the change is not saved")
+	}
+}
+
+func (s *Session) marshal() ([]byte, error) {
+	return json.Marshal(sessionData{
+		Values:  s.values,
+		Flashes: s.flashes,
+	})
+}
+
+func (s *Session) unmarshal(data []byte) error {
+	var d sessionData
+	if err := json.Unmarshal(data, &d); err != nil {
+		return err
+	}
+	if d.Values != nil {
+		s.values = d.Values
+	}
+	s.flashes = d.Flashes
+	return nil
+}
+
+// beforeWriteResponseWriter calls before exactly once, right before the response headers are written
+type beforeWriteResponseWriter struct {
+	http.ResponseWriter
+	before func(w http.ResponseWriter)
+	once   sync.Once
+}
+
+func (w *beforeWriteResponseWriter) WriteHeader(statusCode int) {
+	w.trigger()
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *beforeWriteResponseWriter) Write(b []byte) (int, error) {
+	w.trigger()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *beforeWriteResponseWriter) Flush() {
+	w.trigger()
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *beforeWriteResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *beforeWriteResponseWriter) trigger() {
+	w.once.Do(func() {
+		w.before(w.ResponseWriter)
+	})
+}
@@ -0,0 +1,279 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSessionCodec(t *testing.T) {
+	current := SessionKey{Id: "current", HashKey: bytes.Repeat([]byte{1}, 32), BlockKey: bytes.Repeat([]byte{2}, 32)}
+	previous := SessionKey{Id: "previous", HashKey: bytes.Repeat([]byte{3}, 32)}
+
+	codec, err := NewSessionCodec(current, previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldCodec, err := NewSessionCodec(previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encoded, err := codec.Encode("session", []byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := oldCodec.Encode("session", []byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		cookie string
+		value  string
+		maxAge time.Duration
+		err    error
+	}{
+		{
+			name:   "encoded value",
+			cookie: "session",
+			value:  encoded,
+			maxAge: time.Hour,
+		},
+		{
+			name:   "value encoded with a rotated key",
+			cookie: "session",
+			value:  rotated,
+			maxAge: time.Hour,
+		},
+		{
+			name:   "value bound to another cookie",
+			cookie: "other",
+			value:  encoded,
+			maxAge: time.Hour,
+			err:    ErrSessionInvalid,
+		},
+		{
+			name:   "tampered payload",
+			cookie: "session",
+			value:  tamper(encoded, 2),
+			maxAge: time.Hour,
+			err:    ErrSessionInvalid,
+		},
+		{
+			name:   "unknown key id",
+			cookie: "session",
+			value:  "unknown" + encoded[strings.Index(encoded, "."):],
+			maxAge: time.Hour,
+			err:    ErrSessionInvalid,
+		},
+		{
+			name:   "expired value",
+			cookie: "session",
+			value:  encoded,
+			maxAge: time.Nanosecond,
+			err:    ErrSessionExpired,
+		},
+	}
+
+	// Make sure the values are older than the nanosecond max age
+	time.Sleep(time.Millisecond)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := codec.Decode(tt.cookie, tt.value, tt.maxAge)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Decode() error = %v, want %v", err, tt.err)
+			}
+			if err == nil && string(value) != "value" {
+				t.Errorf("Decode() = %q, want %q", value, "value")
+			}
+		})
+	}
+}
+
+func TestNewSessionCodec(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []SessionKey
+		err  error
+	}{
+		{
+			name: "no keys",
+			err:  ErrSessionKeyInvalid,
+		},
+		{
+			name: "short hash key",
+			keys: []SessionKey{{Id: "a", HashKey: []byte("short")}},
+			err:  ErrSessionKeyInvalid,
+		},
+		{
+			name: "duplicate key id",
+			keys: []SessionKey{{Id: "a", HashKey: bytes.Repeat([]byte{1}, 32)}, {Id: "a", HashKey: bytes.Repeat([]byte{2}, 32)}},
+			err:  ErrSessionKeyInvalid,
+		},
+		{
+			name: "invalid block key",
+			keys: []SessionKey{{Id: "a", HashKey: bytes.Repeat([]byte{1}, 32), BlockKey: []byte("short")}},
+			err:  ErrSessionKeyInvalid,
+		},
+		{
+			name: "valid keys",
+			keys: []SessionKey{{Id: "a", HashKey: bytes.Repeat([]byte{1}, 32)}, {Id: "b", HashKey: bytes.Repeat([]byte{2}, 32)}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewSessionCodec(tt.keys...); !errors.Is(err, tt.err) {
+				t.Errorf("NewSessionCodec() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestSessionManager_Middleware(t *testing.T) {
+	fileStore, err := NewFileSessionStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		store     SessionStore
+		value     string
+		persisted bool
+	}{
+		{
+			name:      "cookie session",
+			value:     "value",
+			persisted: true,
+		},
+		{
+			name:      "cookie session exceeding the cookie size limit",
+			value:     strings.Repeat("a", maxSessionCookieSize),
+			persisted: false,
+		},
+		{
+			name:      "memory store",
+			store:     NewMemorySessionStore(),
+			value:     strings.Repeat("a", maxSessionCookieSize),
+			persisted: true,
+		},
+		{
+			name:      "file store",
+			store:     fileStore,
+			value:     "value",
+			persisted: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			codec, err := NewSessionCodec(SessionKey{Id: "key", HashKey: bytes.Repeat([]byte{1}, 32)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			m := NewSessionManager(codec, tt.store, DefaultSessionOptions())
+			handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				session := GetSession(r.Context())
+				if r.Method == http.MethodPost {
+					session.Set("key", tt.value)
+				}
+				_, _ = w.Write([]byte(session.GetString("key")))
+			}))
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+			cookies := rec.Result().Cookies()
+			if persisted := len(cookies) == 1; persisted != tt.persisted {
+				t.Fatalf("session cookie set = %t, want %t", persisted, tt.persisted)
+			}
+			if !tt.persisted {
+				return
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.AddCookie(cookies[0])
+			rec = httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Body.String() != tt.value {
+				t.Errorf("session value = %q, want %q", rec.Body.String(), tt.value)
+			}
+			if len(rec.Result().Cookies()) != 0 {
+				t.Error("unmodified session was saved")
+			}
+		})
+	}
+}
+
+func TestFileSessionStore(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewFileSessionStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = store.Save(ctx, "aa", []byte("active"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Save(ctx, "bb", []byte("expired"), time.Nanosecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+
+	if data, err := store.Load(ctx, "aa"); err != nil || string(data) != "active" {
+		t.Errorf("Load() = %q, %v, want %q", data, err, "active")
+	}
+	if _, err = store.Load(ctx, "bb"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Load() expired session error = %v, want %v", err, ErrSessionNotFound)
+	}
+	if _, err = store.Load(ctx, "../aa"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Load() invalid id error = %v, want %v", err, ErrSessionNotFound)
+	}
+
+	if err = store.Cleanup(); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Delete(ctx, "aa"); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"aa", "bb"} {
+		if _, err = store.files.Load(id); !errors.Is(err, ErrSessionNotFound) {
+			t.Errorf("session %s still stored, error = %v", id, err)
+		}
+	}
+}
+
+// tamper flips a byte in the given dot separated part of an encoded value
+func tamper(value string, part int) string {
+	parts := strings.Split(value, ".")
+	b := []byte(parts[part])
+	if b[0] == 'A' {
+		b[0] = 'B'
+	} else {
+		b[0] = 'A'
+	}
+	parts[part] = string(b)
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,167 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package server
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type SessionKey struct {
+	Id       string
+	HashKey  []byte
+	BlockKey []byte
+}
+
+// NewSessionCodec creates a codec signing values with HMAC-SHA256 and, when a block key is set, encrypting them with AES-GCM.
+// The first key is used to encode values, all keys are tried when decoding to allow for key rotation.
+func NewSessionCodec(keys ...SessionKey) (*SessionCodec, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w: no keys defined", ErrSessionKeyInvalid)
+	}
+
+	c := &SessionCodec{
+		keys: make([]sessionCodecKey, 0, len(keys)),
+	}
+	ids := make(map[string]struct{}, len(keys))
+	for _, k := range keys {
+		if k.Id == "" || strings.Contains(k.Id, ".") {
+			return nil, fmt.Errorf("%w: invalid key id %q", ErrSessionKeyInvalid, k.Id)
+		}
+		// Decode only tries the first key with a matching id, a duplicate would never be used
+		if _, found := ids[k.Id]; found {
+			return nil, fmt.Errorf("%w: duplicate key id %q", ErrSessionKeyInvalid, k.Id)
+		}
+		ids[k.Id] = struct{}{}
+		if len(k.HashKey) < 32 {
+			return nil, fmt.Errorf("%w: hash key %s must be at least 32 bytes", ErrSessionKeyInvalid, k.Id)
+		}
+
+		key := sessionCodecKey{
+			id:      k.Id,
+			hashKey: k.HashKey,
+		}
+		if len(k.BlockKey) > 0 {
+			block, err := aes.NewCipher(k.BlockKey)
+			if err != nil {
+				return nil, fmt.Errorf("%w: block key %s: %w", ErrSessionKeyInvalid, k.Id, err)
+			}
+			if key.aead, err = cipher.NewGCM(block); err != nil {
+				return nil, err
+			}
+		}
+		c.keys = append(c.keys, key)
+	}
+	return c, nil
+}
+
+type SessionCodec struct {
+	keys []sessionCodecKey
+}
+
+type sessionCodecKey struct {
+	id      string
+	hashKey []byte
+	aead    cipher.AEAD
+}
+
+// Encode returns a cookie-safe representation of value, bound to the cookie name
+func (c *SessionCodec) Encode(name string, value []byte) (string, error) {
+	key := c.keys[0]
+
+	payload := value
+	if key.aead != nil {
+		nonce := make([]byte, key.aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return "", err
+		}
+		payload = key.aead.Seal(nonce, nonce, value, []byte(name))
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	mac := key.sign(name, key.id, timestamp, encoded)
+	return strings.Join([]string{key.id, timestamp, encoded, base64.RawURLEncoding.EncodeToString(mac)}, "."), nil
+}
+
+// Decode verifies and decrypts a value created by Encode, values older than maxAge are rejected
+func (c *SessionCodec) Decode(name string, value string, maxAge time.Duration) ([]byte, error) {
+	parts := strings.Split(value, ".")
+	if len(parts) != 4 {
+		return nil, ErrSessionInvalid
+	}
+	keyId, timestamp, encoded := parts[0], parts[1], parts[2]
+
+	mac, err := base64.RawURLEncoding.DecodeString(parts[3])
+	if err != nil {
+		return nil, ErrSessionInvalid
+	}
+
+	for _, key := range c.keys {
+		if key.id != keyId {
+			continue
+		}
+		if !hmac.Equal(mac, key.sign(name, keyId, timestamp, encoded)) {
+			return nil, ErrSessionInvalid
+		}
+
+		var created int64
+		if created, err = strconv.ParseInt(timestamp, 10, 64); err != nil {
+			return nil, ErrSessionInvalid
+		}
+		if maxAge > 0 && time.Since(time.Unix(created, 0)) > maxAge {
+			return nil, ErrSessionExpired
+		}
+
+		var payload []byte
+		if payload, err = base64.RawURLEncoding.DecodeString(encoded); err != nil {
+			return nil, ErrSessionInvalid
+		}
+		if key.aead == nil {
+			return payload, nil
+		}
+
+		nonceSize := key.aead.NonceSize()
+		if len(payload) < nonceSize {
+			return nil, ErrSessionInvalid
+		}
+		if payload, err = key.aead.Open(nil, payload[:nonceSize], payload[nonceSize:], []byte(name)); err != nil {
+			return nil, ErrSessionInvalid
+		}
+		return payload, nil
+	}
+	return nil, ErrSessionInvalid
+}
+
+// sign prefixes every part with its length, so moving bytes from one part into the next changes the signature
+func (k sessionCodecKey) sign(parts ...string) []byte {
+	h := hmac.New(sha256.New, k.hashKey)
+	for _, part := range parts {
+		h.Write(binary.BigEndian.AppendUint64(nil, uint64(len(part))))
+		h.Write([]byte(part))
+	}
+	return h.Sum(nil)
+}
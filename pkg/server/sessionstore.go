@@ -0,0 +1,142 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/corelayer/go-kit/pkg/internal/filestore"
+)
+
+type SessionStore interface {
+	Load(ctx context.Context, id string) ([]byte, error)
+	Save(ctx context.Context, id string, data []byte, ttl time.Duration) error
+	Delete(ctx context.Context, id string) error
+}
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		sessions: make(map[string]storedSession),
+	}
+}
+
+type MemorySessionStore struct {
+	sessions map[string]storedSession
+	mux      sync.Mutex
+}
+
+type storedSession struct {
+	Data    []byte    `json:"data"`
+	Expires time.Time `json:"expires"`
+}
+
+func (s storedSession) expired() bool {
+	return !s.Expires.IsZero() && time.Now().After(s.Expires)
+}
+
+func (m *MemorySessionStore) Load(_ context.Context, id string) ([]byte, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	stored, found := m.sessions[id]
+	if !found {
+		return nil, ErrSessionNotFound
+	}
+	if stored.expired() {
+		delete(m.sessions, id)
+		return nil, ErrSessionNotFound
+	}
+	return stored.Data, nil
+}
+
+func (m *MemorySessionStore) Save(_ context.Context, id string, data []byte, ttl time.Duration) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	m.sessions[id] = storedSession{
+		Data:    data,
+		Expires: expiresAt(ttl),
+	}
+	return nil
+}
+
+func (m *MemorySessionStore) Delete(_ context.Context, id string) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	delete(m.sessions, id)
+	return nil
+}
+
+// Cleanup removes all expired sessions from the store
+func (m *MemorySessionStore) Cleanup() {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+
+	for id, stored := range m.sessions {
+		if stored.expired() {
+			delete(m.sessions, id)
+		}
+	}
+}
+
+func NewFileSessionStore(path string) (*FileSessionStore, error) {
+	files, err := filestore.New[storedSession](path, ".session", ErrSessionNotFound)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSessionStore{
+		files: files,
+	}, nil
+}
+
+type FileSessionStore struct {
+	files *filestore.Store[storedSession]
+}
+
+func (f *FileSessionStore) Load(_ context.Context, id string) ([]byte, error) {
+	stored, err := f.files.Load(id)
+	if err != nil {
+		return nil, err
+	}
+	if stored.expired() {
+		return nil, ErrSessionNotFound
+	}
+	return stored.Data, nil
+}
+
+func (f *FileSessionStore) Save(_ context.Context, id string, data []byte, ttl time.Duration) error {
+	return f.files.Save(id, storedSession{Data: data, Expires: expiresAt(ttl)})
+}
+
+func (f *FileSessionStore) Delete(_ context.Context, id string) error {
+	return f.files.Delete(id)
+}
+
+// Cleanup removes all expired sessions from the store
+func (f *FileSessionStore) Cleanup() error {
+	return f.files.DeleteFunc(storedSession.expired)
+}
+
+func expiresAt(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
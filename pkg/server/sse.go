@@ -0,0 +1,191 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type SseEvent struct {
+	Id    string
+	Event string
+	Data  string
+	Retry time.Duration
+}
+
+func NewSseWriter(w http.ResponseWriter, r *http.Request, heartbeat time.Duration, writeTimeout time.Duration) (*SseWriter, error) {
+	rc := http.NewResponseController(w)
+
+	// Clear the deadline configured by HttpServer.WriteTimeout, the stream would be cut off otherwise
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return nil, err
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	// Flushing sends the status line and headers, a writer which cannot flush has not written anything yet
+	if err := rc.Flush(); err != nil {
+		if !errors.Is(err, http.ErrNotSupported) {
+			return nil, err
+		}
+		for _, header := range []string{"Content-Type", "Cache-Control", "Connection", "X-Accel-Buffering"} {
+			w.Header().Del(header)
+		}
+		WriteProblem(w, NewProblem(http.StatusInternalServerError, ErrSseNotSupportedMessage))
+		return nil, ErrSseNotSupported
+	}
+
+	s := &SseWriter{
+		w:            w,
+		rc:           rc,
+		ctx:          r.Context(),
+		lastEventId:  r.Header.Get("Last-Event-ID"),
+		heartbeat:    heartbeat,
+		writeTimeout: writeTimeout,
+	}
+	return s, nil
+}
+
+type SseWriter struct {
+	w            http.ResponseWriter
+	rc           *http.ResponseController
+	ctx          context.Context
+	lastEventId  string
+	heartbeat    time.Duration
+	writeTimeout time.Duration
+	lastWrite    time.Time
+	mux          sync.Mutex
+}
+
+// Done is closed when the client disconnects
+func (s *SseWriter) Done() <-chan struct{} {
+	return s.ctx.Done()
+}
+
+func (s *SseWriter) LastEventId() string {
+	return s.lastEventId
+}
+
+func (s *SseWriter) Send(e SseEvent) error {
+	var b strings.Builder
+	if e.Id != "" {
+		b.WriteString("id: " + sanitizeSseField(e.Id) + "\n")
+	}
+	if e.Event != "" {
+		b.WriteString("event: " + sanitizeSseField(e.Event) + "\n")
+	}
+	if e.Retry > 0 {
+		b.WriteString("retry: " + strconv.FormatInt(e.Retry.Milliseconds(), 10) + "\n")
+	}
+	// CR LF, CR and LF all end a line for the client, each line needs its own data field
+	data := strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(e.Data)
+	for _, line := range strings.Split(data, "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+	return s.write(b.String())
+}
+
+func (s *SseWriter) Comment(comment string) error {
+	return s.write(": " + sanitizeSseField(comment) + "\n\n")
+}
+
+func (s *SseWriter) Retry(d time.Duration) error {
+	return s.write(fmt.Sprintf("retry: %d\n\n", d.Milliseconds()))
+}
+
+// Serve writes all events received on the channel until it is closed, the client disconnects or ctx is cancelled.
+// A heartbeat comment is sent when nothing was written during the heartbeat interval, including events sent outside Serve.
+func (s *SseWriter) Serve(ctx context.Context, events <-chan SseEvent) error {
+	var (
+		timer     *time.Timer
+		heartbeat <-chan time.Time
+	)
+	if s.heartbeat > 0 {
+		timer = time.NewTimer(s.heartbeat)
+		defer timer.Stop()
+		heartbeat = timer.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.ctx.Done():
+			return s.ctx.Err()
+		case <-heartbeat:
+			if idle := s.idle(); idle < s.heartbeat {
+				timer.Reset(s.heartbeat - idle)
+				continue
+			}
+			if err := s.Comment("heartbeat"); err != nil {
+				return err
+			}
+			timer.Reset(s.heartbeat)
+		case e, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if err := s.Send(e); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// idle returns the time since the last write
+func (s *SseWriter) idle() time.Duration {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return time.Since(s.lastWrite)
+}
+
+func (s *SseWriter) write(data string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+
+	if s.writeTimeout > 0 {
+		if err := s.rc.SetWriteDeadline(time.Now().Add(s.writeTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+	}
+
+	if _, err := io.WriteString(s.w, data); err != nil {
+		return err
+	}
+	s.lastWrite = time.Now()
+	return s.rc.Flush()
+}
+
+func sanitizeSseField(value string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(value)
+}
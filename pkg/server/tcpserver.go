@@ -0,0 +1,390 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// tcpHandlerExitTimeout is the time handlers get to return after the shutdown period expired and their
+// contexts were cancelled, the process exits when they are still running afterwards
+const tcpHandlerExitTimeout = 5 * time.Second
+
+type TcpHandler interface {
+	// ServeTcp handles a connection, which is closed by the server when ServeTcp returns.
+	// The context is cancelled when the graceful shutdown period of the server expires,
+	// handlers must return shortly afterwards or the process exits.
+	ServeTcp(ctx context.Context, conn net.Conn)
+}
+
+type TcpHandlerFunc func(ctx context.Context, conn net.Conn)
+
+func (f TcpHandlerFunc) ServeTcp(ctx context.Context, conn net.Conn) {
+	f(ctx, conn)
+}
+
+func NewTcpServer(address string, port int, handler TcpHandler) *TcpServer {
+	drainCtx, drainCancel := context.WithCancel(context.Background())
+	baseCtx, baseCancel := context.WithCancel(context.Background())
+
+	return &TcpServer{
+		Addr:            address + ":" + strconv.Itoa(port),
+		Handler:         handler,
+		ShutdownTimeout: 30 * time.Second,
+		conns:           make(map[net.Conn]struct{}),
+		done:            make(chan struct{}),
+		stop:            make(chan struct{}),
+		drainCtx:        drainCtx,
+		drainCancel:     drainCancel,
+		baseCtx:         baseCtx,
+		baseCancel:      baseCancel,
+	}
+}
+
+func NewTlsTcpServer(address string, port int, pubKey string, privKey string, handler TcpHandler) *TcpServer {
+	s := NewTcpServer(address, port, handler)
+	s.UseTls = pubKey != "" && privKey != ""
+	s.PublicKey = pubKey
+	s.PrivateKey = privKey
+	return s
+}
+
+type TcpServer struct {
+	Addr       string
+	Handler    TcpHandler
+	UseTls     bool
+	PublicKey  string
+	PrivateKey string
+	// TlsConfig is used for TLS connections, certificates are loaded from PublicKey and PrivateKey when it has none
+	TlsConfig *tls.Config
+
+	MaxConnections  int
+	IdleTimeout     time.Duration
+	ShutdownTimeout time.Duration
+
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	handlers sync.WaitGroup
+	done     chan struct{}
+	closing  bool
+	stop     chan struct{}
+	stopOnce sync.Once
+	mux      sync.Mutex
+
+	drainCtx    context.Context
+	drainCancel context.CancelFunc
+	baseCtx     context.Context
+	baseCancel  context.CancelFunc
+}
+
+func (s *TcpServer) RunServer(ctx context.Context) {
+	runServer(ctx, s.stop, s.start, s.shutdown)
+}
+
+// Stop triggers the same graceful shutdown as a termination signal, RunServer returns once it has completed
+func (s *TcpServer) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+}
+
+func (s *TcpServer) Status() map[string]any {
+	return map[string]any{
+		"address":     s.protocol() + s.Addr,
+		"connections": s.ActiveConnections(),
+	}
+}
+
+func (s *TcpServer) ActiveConnections() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return len(s.conns)
+}
+
+// ListenAndServe accepts connections until the server is shut down
+func (s *TcpServer) ListenAndServe() error {
+	var (
+		err      error
+		listener net.Listener
+	)
+
+	if listener, err = net.Listen("tcp", s.Addr); err != nil {
+		return err
+	}
+
+	if s.UseTls || s.TlsConfig != nil {
+		config := s.TlsConfig
+		if config == nil {
+			config = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		if len(config.Certificates) == 0 && config.GetCertificate == nil {
+			var cert tls.Certificate
+			if cert, err = tls.LoadX509KeyPair(s.PublicKey, s.PrivateKey); err != nil {
+				_ = listener.Close()
+				return err
+			}
+			config = config.Clone()
+			config.Certificates = []tls.Certificate{cert}
+		}
+		listener = tls.NewListener(listener, config)
+	}
+	return s.Serve(listener)
+}
+
+func (s *TcpServer) Serve(listener net.Listener) error {
+	s.mux.Lock()
+	if s.closing {
+		s.mux.Unlock()
+		_ = listener.Close()
+		return ErrServerClosed
+	}
+	s.listener = listener
+	s.mux.Unlock()
+
+	var slots chan struct{}
+	if s.MaxConnections > 0 {
+		slots = make(chan struct{}, s.MaxConnections)
+	}
+
+	var delay time.Duration
+	for {
+		// Stop accepting connections while the connection limit is reached
+		if slots != nil {
+			select {
+			case slots <- struct{}{}:
+			case <-s.done:
+				return ErrServerClosed
+			}
+		}
+
+		conn, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-s.done:
+				return ErrServerClosed
+			default:
+			}
+
+			if temporaryAcceptError(err) {
+				if slots != nil {
+					<-slots
+				}
+
+				// Back off like http.Server, e.g. to give connections time to close when running out of file descriptors
+				if delay == 0 {
+					delay = 5 * time.Millisecond
+				} else if delay *= 2; delay > time.Second {
+					delay = time.Second
+				}
+				slog.Warn("could not accept connection, retrying", "address", listener.Addr().String(), "delay", delay, "error", err)
+				select {
+				case <-s.done:
+					return ErrServerClosed
+				case <-time.After(delay):
+				}
+				continue
+			}
+			return err
+		}
+		delay = 0
+
+		if !s.track(conn) {
+			_ = conn.Close()
+			return ErrServerClosed
+		}
+
+		go func() {
+			defer func() {
+				if slots != nil {
+					<-slots
+				}
+			}()
+			s.serveConn(conn)
+		}()
+	}
+}
+
+// Shutdown stops accepting connections and waits for all handlers to return.
+// When ctx expires first, the connection contexts are cancelled and all connections are closed.
+func (s *TcpServer) Shutdown(ctx context.Context) error {
+	s.mux.Lock()
+	if !s.closing {
+		s.closing = true
+		close(s.done)
+		if s.listener != nil {
+			_ = s.listener.Close()
+		}
+	}
+	s.mux.Unlock()
+	s.drainCancel()
+
+	finished := make(chan struct{})
+	go func() {
+		s.handlers.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+	}
+
+	s.baseCancel()
+	s.mux.Lock()
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mux.Unlock()
+	return ctx.Err()
+}
+
+func (s *TcpServer) start() {
+	slog.Info("server starting", "address", s.protocol()+s.Addr)
+	if err := s.ListenAndServe(); err != nil && !errors.Is(err, ErrServerClosed) {
+		slog.Error("could not start server", "address", s.Addr, "error", err)
+	}
+}
+
+func (s *TcpServer) shutdown(c context.Context) {
+	address := s.protocol() + s.Addr
+
+	// Shutdown signal with grace period
+	shutdownCtx, cancel := context.WithTimeout(c, s.ShutdownTimeout)
+	defer cancel()
+
+	slog.Info("shutting down server", "address", address, "connections", s.ActiveConnections())
+	err := s.Shutdown(shutdownCtx)
+	if err == nil {
+		return
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		slog.Error("could not shutdown server", "address", address, "error", err)
+		return
+	}
+
+	// Connection contexts are cancelled and connections are closed, give handlers a moment to return before exiting
+	slog.Error("graceful shutdown timed out", "address", address, "connections", s.ActiveConnections(), "error", err)
+	if !s.waitHandlers(tcpHandlerExitTimeout) {
+		slog.Error("handlers did not return after closing connections", "address", address, "connections", s.ActiveConnections())
+		os.Exit(1)
+	}
+}
+
+// waitHandlers reports whether all handlers returned within timeout
+func (s *TcpServer) waitHandlers(timeout time.Duration) bool {
+	finished := make(chan struct{})
+	go func() {
+		s.handlers.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func (s *TcpServer) serveConn(conn net.Conn) {
+	defer s.handlers.Done()
+	defer s.untrack(conn)
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(context.WithValue(s.baseCtx, shutdownContextKey{}, s.drainCtx))
+	defer cancel()
+
+	if s.IdleTimeout > 0 {
+		conn = &idleTimeoutConn{Conn: conn, timeout: s.IdleTimeout}
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("tcp handler panic", "remote", conn.RemoteAddr().String(), "error", r)
+		}
+	}()
+	s.Handler.ServeTcp(ctx, conn)
+}
+
+func (s *TcpServer) track(conn net.Conn) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if s.closing {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	s.handlers.Add(1)
+	return true
+}
+
+func (s *TcpServer) untrack(conn net.Conn) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	delete(s.conns, conn)
+}
+
+func (s *TcpServer) protocol() string {
+	if s.UseTls || s.TlsConfig != nil {
+		return "tls://"
+	}
+	return "tcp://"
+}
+
+// idleTimeoutConn extends the connection deadline on every read and write
+type idleTimeoutConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *idleTimeoutConn) Read(b []byte) (int, error) {
+	if err := c.Conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *idleTimeoutConn) Write(b []byte) (int, error) {
+	if err := c.Conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Write(b)
+}
+
+// temporaryAcceptError reports whether accepting connections may succeed again after a while
+func temporaryAcceptError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	for _, errno := range []syscall.Errno{syscall.EMFILE, syscall.ENFILE, syscall.ENOBUFS, syscall.ENOMEM, syscall.ECONNABORTED, syscall.ECONNRESET} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
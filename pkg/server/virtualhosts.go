@@ -0,0 +1,102 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package server
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// NewVirtualHosts creates a handler dispatching requests based on the Host header.
+// Requests for unknown hosts are handled by fallback, or answered with 404 Not Found when fallback is nil.
+func NewVirtualHosts(fallback http.Handler) *VirtualHosts {
+	return &VirtualHosts{
+		hosts:     make(map[string]http.Handler),
+		wildcards: make(map[string]http.Handler),
+		fallback:  fallback,
+	}
+}
+
+type VirtualHosts struct {
+	hosts     map[string]http.Handler
+	wildcards map[string]http.Handler
+	fallback  http.Handler
+	mux       sync.RWMutex
+}
+
+// Handle registers the handler for host, a host starting with "*." matches exactly one additional label
+func (v *VirtualHosts) Handle(host string, h http.Handler) {
+	v.mux.Lock()
+	defer v.mux.Unlock()
+
+	host = normalizeHost(host)
+	if suffix, found := strings.CutPrefix(host, "*."); found {
+		v.wildcards[suffix] = h
+		return
+	}
+	v.hosts[host] = h
+}
+
+func (v *VirtualHosts) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h, _ := v.match(r.Host); h != nil {
+		h.ServeHTTP(w, r)
+		return
+	}
+	http.NotFound(w, r)
+}
+
+// Handler implements RouteResolver, the pattern is prefixed by the matching host
+func (v *VirtualHosts) Handler(r *http.Request) (http.Handler, string) {
+	h, host := v.match(r.Host)
+	if h == nil {
+		return nil, ""
+	}
+	if resolver, ok := h.(RouteResolver); ok {
+		if _, pattern := resolver.Handler(r); pattern != "" {
+			return h, host + " " + pattern
+		}
+	}
+	return h, host
+}
+
+func (v *VirtualHosts) match(requestHost string) (http.Handler, string) {
+	v.mux.RLock()
+	defer v.mux.RUnlock()
+
+	host := normalizeHost(requestHost)
+	if h, found := v.hosts[host]; found {
+		return h, host
+	}
+	if _, suffix, found := strings.Cut(host, "."); found {
+		if h, found := v.wildcards[suffix]; found {
+			return h, "*." + suffix
+		}
+	}
+	if v.fallback != nil {
+		return v.fallback, "*"
+	}
+	return nil, ""
+}
+
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
@@ -0,0 +1,647 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+type WebSocketMessageType int
+
+const (
+	WebSocketContinuationMessage WebSocketMessageType = 0x0
+	WebSocketTextMessage         WebSocketMessageType = 0x1
+	WebSocketBinaryMessage       WebSocketMessageType = 0x2
+	WebSocketCloseMessage        WebSocketMessageType = 0x8
+	WebSocketPingMessage         WebSocketMessageType = 0x9
+	WebSocketPongMessage         WebSocketMessageType = 0xA
+)
+
+const (
+	WebSocketCloseNormalClosure      = 1000
+	WebSocketCloseGoingAway          = 1001
+	WebSocketCloseProtocolError      = 1002
+	WebSocketCloseUnsupportedData    = 1003
+	WebSocketCloseNoStatusReceived   = 1005
+	WebSocketCloseAbnormalClosure    = 1006
+	WebSocketCloseInvalidPayloadData = 1007
+	WebSocketClosePolicyViolation    = 1008
+	WebSocketCloseMessageTooBig      = 1009
+	WebSocketCloseInternalError      = 1011
+)
+
+const webSocketGuid = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// deflateTail is appended to compressed messages before inflating, RFC 7692 - section 7.2.2
+var deflateTail = []byte{0x00, 0x00, 0xff, 0xff, 0x01, 0x00, 0x00, 0xff, 0xff}
+
+type WebSocketCloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *WebSocketCloseError) Error() string {
+	return fmt.Sprintf("websocket closed: %d %s", e.Code, e.Reason)
+}
+
+// DefaultWebSocketMaxMessageSize also applies when MaxMessageSize is not set
+const DefaultWebSocketMaxMessageSize = 1 << 20
+
+func NewWebSocketUpgrader() *WebSocketUpgrader {
+	return &WebSocketUpgrader{
+		MaxMessageSize: DefaultWebSocketMaxMessageSize,
+		CloseTimeout:   5 * time.Second,
+		conns:          make(map[*WebSocketConn]struct{}),
+	}
+}
+
+type WebSocketUpgrader struct {
+	Subprotocols      []string
+	CheckOrigin       func(r *http.Request) bool
+	MaxMessageSize    int64
+	EnableCompression bool
+	CloseTimeout      time.Duration
+
+	conns map[*WebSocketConn]struct{}
+	mux   sync.Mutex
+}
+
+func (u *WebSocketUpgrader) Upgrade(w http.ResponseWriter, r *http.Request, header http.Header) (*WebSocketConn, error) {
+	var (
+		err error
+		nc  net.Conn
+		brw *bufio.ReadWriter
+	)
+
+	if r.Method != http.MethodGet {
+		return nil, u.fail(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+	if !headerContainsToken(r.Header, "Connection", "upgrade") || !headerContainsToken(r.Header, "Upgrade", "websocket") {
+		return nil, u.fail(w, http.StatusBadRequest, "missing upgrade headers")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		return nil, u.fail(w, http.StatusUpgradeRequired, "unsupported websocket version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, decodeErr := base64.StdEncoding.DecodeString(key); decodeErr != nil || len(decoded) != 16 {
+		return nil, u.fail(w, http.StatusBadRequest, "invalid websocket key")
+	}
+
+	checkOrigin := u.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = sameOrigin
+	}
+	if !checkOrigin(r) {
+		return nil, u.fail(w, http.StatusForbidden, "origin not allowed")
+	}
+
+	subprotocol := u.selectSubprotocol(r)
+	compress := u.EnableCompression && acceptsPerMessageDeflate(r.Header)
+
+	if nc, brw, err = http.NewResponseController(w).Hijack(); err != nil {
+		return nil, u.fail(w, http.StatusInternalServerError, err.Error())
+	}
+
+	var b strings.Builder
+	b.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+	b.WriteString("Sec-WebSocket-Accept: " + webSocketAccept(key) + "\r\n")
+	if subprotocol != "" {
+		b.WriteString("Sec-WebSocket-Protocol: " + subprotocol + "\r\n")
+	}
+	if compress {
+		b.WriteString("Sec-WebSocket-Extensions: permessage-deflate; server_no_context_takeover; client_no_context_takeover\r\n")
+	}
+	for k, values := range header {
+		for _, v := range values {
+			b.WriteString(k + ": " + v + "\r\n")
+		}
+	}
+	b.WriteString("\r\n")
+
+	// Clear deadlines inherited from the http server
+	_ = nc.SetDeadline(time.Time{})
+	if _, err = nc.Write([]byte(b.String())); err != nil {
+		_ = nc.Close()
+		return nil, err
+	}
+
+	maxMessageSize := u.MaxMessageSize
+	if maxMessageSize <= 0 {
+		maxMessageSize = DefaultWebSocketMaxMessageSize
+	}
+
+	c := &WebSocketConn{
+		conn:           nc,
+		reader:         brw.Reader,
+		subprotocol:    subprotocol,
+		compress:       compress,
+		maxMessageSize: maxMessageSize,
+		closeTimeout:   u.CloseTimeout,
+		closeReceived:  make(chan struct{}),
+		upgrader:       u,
+	}
+	u.mux.Lock()
+	u.conns[c] = struct{}{}
+	u.mux.Unlock()
+	return c, nil
+}
+
+// CloseAll sends a close frame to all open connections and waits for the close handshakes to complete
+func (u *WebSocketUpgrader) CloseAll(code int, reason string) {
+	u.mux.Lock()
+	conns := make([]*WebSocketConn, 0, len(u.conns))
+	for c := range u.conns {
+		conns = append(conns, c)
+	}
+	u.mux.Unlock()
+
+	var wg sync.WaitGroup
+	for _, c := range conns {
+		wg.Add(1)
+		go func(c *WebSocketConn) {
+			defer wg.Done()
+			_ = c.Close(code, reason)
+		}(c)
+	}
+	wg.Wait()
+}
+
+func (u *WebSocketUpgrader) Count() int {
+	u.mux.Lock()
+	defer u.mux.Unlock()
+	return len(u.conns)
+}
+
+func (u *WebSocketUpgrader) fail(w http.ResponseWriter, status int, reason string) error {
+	http.Error(w, http.StatusText(status), status)
+	return fmt.Errorf("%w: %s", ErrWebSocketHandshake, reason)
+}
+
+func (u *WebSocketUpgrader) release(c *WebSocketConn) {
+	u.mux.Lock()
+	defer u.mux.Unlock()
+	delete(u.conns, c)
+}
+
+func (u *WebSocketUpgrader) selectSubprotocol(r *http.Request) string {
+	for _, requested := range headerTokens(r.Header, "Sec-WebSocket-Protocol") {
+		for _, supported := range u.Subprotocols {
+			if requested == supported {
+				return supported
+			}
+		}
+	}
+	return ""
+}
+
+type WebSocketConn struct {
+	conn           net.Conn
+	reader         *bufio.Reader
+	subprotocol    string
+	compress       bool
+	maxMessageSize int64
+	closeTimeout   time.Duration
+	upgrader       *WebSocketUpgrader
+
+	PongHandler func(data []byte)
+
+	writeMux      sync.Mutex
+	reading       atomic.Bool
+	closeSent     atomic.Bool
+	closeOnce     sync.Once
+	closeReceived chan struct{}
+	receivedOnce  sync.Once
+}
+
+func (c *WebSocketConn) Subprotocol() string {
+	return c.subprotocol
+}
+
+func (c *WebSocketConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+func (c *WebSocketConn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+func (c *WebSocketConn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+// ReadMessage returns the next text or binary message.
+// Control frames are handled transparently: pings are answered and close frames complete the close handshake.
+// When the peer closes the connection, a *WebSocketCloseError is returned.
+func (c *WebSocketConn) ReadMessage() (WebSocketMessageType, []byte, error) {
+	c.reading.Store(true)
+	defer c.reading.Store(false)
+
+	var (
+		messageType WebSocketMessageType
+		compressed  bool
+		message     []byte
+	)
+
+	for {
+		fin, rsv1, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, c.readFailed(err)
+		}
+
+		switch opcode {
+		case WebSocketPingMessage:
+			if err = c.writeFrame(WebSocketPongMessage, payload, false); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case WebSocketPongMessage:
+			if c.PongHandler != nil {
+				c.PongHandler(payload)
+			}
+			continue
+		case WebSocketCloseMessage:
+			// A close payload holds at least the two byte status code when present
+			if len(payload) == 1 {
+				return 0, nil, c.readFailed(fmt.Errorf("%w: invalid close frame", ErrWebSocketProtocolError))
+			}
+			if len(payload) >= 2 {
+				if code := int(binary.BigEndian.Uint16(payload)); !validCloseCode(code) {
+					return 0, nil, c.readFailed(fmt.Errorf("%w: invalid close code %d", ErrWebSocketProtocolError, code))
+				}
+				if !utf8.Valid(payload[2:]) {
+					return 0, nil, c.readFailed(fmt.Errorf("%w: invalid utf-8 in close reason", ErrWebSocketInvalidPayload))
+				}
+			}
+			return 0, nil, c.closeFrameReceived(payload)
+		case WebSocketTextMessage, WebSocketBinaryMessage:
+			if messageType != 0 {
+				return 0, nil, c.readFailed(fmt.Errorf("%w: expected continuation frame", ErrWebSocketProtocolError))
+			}
+			if rsv1 && !c.compress {
+				return 0, nil, c.readFailed(fmt.Errorf("%w: unexpected compressed frame", ErrWebSocketProtocolError))
+			}
+			messageType, compressed = opcode, rsv1
+		case WebSocketContinuationMessage:
+			if messageType == 0 || rsv1 {
+				return 0, nil, c.readFailed(fmt.Errorf("%w: unexpected continuation frame", ErrWebSocketProtocolError))
+			}
+		default:
+			return 0, nil, c.readFailed(fmt.Errorf("%w: unknown opcode %d", ErrWebSocketProtocolError, opcode))
+		}
+
+		if int64(len(message)+len(payload)) > c.maxMessageSize {
+			return 0, nil, c.readFailed(ErrWebSocketMessageTooBig)
+		}
+		message = append(message, payload...)
+		if !fin {
+			continue
+		}
+
+		if compressed {
+			if message, err = c.inflate(message); err != nil {
+				return 0, nil, c.readFailed(err)
+			}
+		}
+		if messageType == WebSocketTextMessage && !utf8.Valid(message) {
+			return 0, nil, c.readFailed(fmt.Errorf("%w: invalid utf-8 in text message", ErrWebSocketInvalidPayload))
+		}
+		return messageType, message, nil
+	}
+}
+
+func (c *WebSocketConn) WriteMessage(messageType WebSocketMessageType, data []byte) error {
+	if messageType != WebSocketTextMessage && messageType != WebSocketBinaryMessage {
+		return fmt.Errorf("%w: invalid message type %d", ErrWebSocketProtocolError, messageType)
+	}
+	if c.closeSent.Load() {
+		return ErrWebSocketClosed
+	}
+
+	if !c.compress {
+		return c.writeFrame(messageType, data, false)
+	}
+
+	var buf bytes.Buffer
+	fw, err := flate.NewWriter(&buf, flate.BestSpeed)
+	if err != nil {
+		return err
+	}
+	if _, err = fw.Write(data); err != nil {
+		return err
+	}
+	if err = fw.Flush(); err != nil {
+		return err
+	}
+	return c.writeFrame(messageType, bytes.TrimSuffix(buf.Bytes(), deflateTail[:4]), true)
+}
+
+func (c *WebSocketConn) Ping(data []byte) error {
+	if len(data) > 125 {
+		return fmt.Errorf("%w: control frame payload too large", ErrWebSocketProtocolError)
+	}
+	return c.writeFrame(WebSocketPingMessage, data, false)
+}
+
+// Close starts the close handshake and waits for the peer to acknowledge it, or until the close timeout expires
+func (c *WebSocketConn) Close(code int, reason string) error {
+	err := c.sendClose(code, reason)
+
+	if c.reading.Load() {
+		// A concurrent ReadMessage will receive the close frame of the peer
+		select {
+		case <-c.closeReceived:
+		case <-time.After(c.closeTimeout):
+		}
+	} else {
+		_ = c.conn.SetReadDeadline(time.Now().Add(c.closeTimeout))
+		for {
+			_, _, opcode, _, readErr := c.readFrame()
+			if readErr != nil || opcode == WebSocketCloseMessage {
+				break
+			}
+		}
+	}
+
+	c.release()
+	return err
+}
+
+func (c *WebSocketConn) sendClose(code int, reason string) error {
+	if !c.closeSent.CompareAndSwap(false, true) {
+		return nil
+	}
+
+	var payload []byte
+	if code != WebSocketCloseNoStatusReceived {
+		payload = binary.BigEndian.AppendUint16(payload, uint16(code))
+		payload = append(payload, truncateCloseReason(reason)...)
+	}
+	return c.writeFrame(WebSocketCloseMessage, payload, false)
+}
+
+func (c *WebSocketConn) closeFrameReceived(payload []byte) error {
+	closeErr := &WebSocketCloseError{Code: WebSocketCloseNoStatusReceived}
+	if len(payload) >= 2 {
+		closeErr.Code = int(binary.BigEndian.Uint16(payload))
+		closeErr.Reason = string(payload[2:])
+	}
+
+	c.receivedOnce.Do(func() {
+		close(c.closeReceived)
+	})
+
+	// Echo the close frame if the peer initiated the close handshake
+	if !c.closeSent.Load() {
+		code := closeErr.Code
+		if code == WebSocketCloseNoStatusReceived {
+			code = WebSocketCloseNormalClosure
+		}
+		_ = c.sendClose(code, "")
+		c.release()
+	}
+	return closeErr
+}
+
+// validCloseCode reports whether a peer may send code in a close frame, codes reserved for local use such as 1005 and 1006 are rejected
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1014:
+		return true
+	case code >= 3000 && code <= 4999:
+		return true
+	}
+	return false
+}
+
+// truncateCloseReason limits reason to the 123 bytes which fit in a control frame, without splitting a UTF-8 sequence
+func truncateCloseReason(reason string) string {
+	const maxReasonLength = 123
+	if len(reason) <= maxReasonLength {
+		return reason
+	}
+	n := maxReasonLength
+	for n > 0 && !utf8.RuneStart(reason[n]) {
+		n--
+	}
+	return reason[:n]
+}
+
+func (c *WebSocketConn) readFailed(err error) error {
+	switch {
+	case errors.Is(err, ErrWebSocketMessageTooBig):
+		_ = c.sendClose(WebSocketCloseMessageTooBig, "message too big")
+	case errors.Is(err, ErrWebSocketProtocolError):
+		_ = c.sendClose(WebSocketCloseProtocolError, "protocol error")
+	case errors.Is(err, ErrWebSocketInvalidPayload):
+		_ = c.sendClose(WebSocketCloseInvalidPayloadData, "invalid payload data")
+	case errors.As(err, new(flate.CorruptInputError)):
+		_ = c.sendClose(WebSocketCloseInvalidPayloadData, "invalid compressed data")
+	}
+	c.release()
+	return err
+}
+
+func (c *WebSocketConn) release() {
+	c.closeOnce.Do(func() {
+		_ = c.conn.Close()
+		c.upgrader.release(c)
+	})
+}
+
+func (c *WebSocketConn) readFrame() (bool, bool, WebSocketMessageType, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return false, false, 0, nil, err
+	}
+
+	fin := header[0]&0x80 != 0
+	rsv1 := header[0]&0x40 != 0
+	opcode := WebSocketMessageType(header[0] & 0x0f)
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7f)
+
+	if header[0]&0x30 != 0 {
+		return false, false, 0, nil, fmt.Errorf("%w: reserved bits set", ErrWebSocketProtocolError)
+	}
+	if !masked {
+		return false, false, 0, nil, fmt.Errorf("%w: client frames must be masked", ErrWebSocketProtocolError)
+	}
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return false, false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+		if length < 126 {
+			return false, false, 0, nil, fmt.Errorf("%w: non-minimal frame length", ErrWebSocketProtocolError)
+		}
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return false, false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+		if length&(1<<63) != 0 {
+			return false, false, 0, nil, fmt.Errorf("%w: frame length with most significant bit set", ErrWebSocketProtocolError)
+		}
+		if length <= 0xffff {
+			return false, false, 0, nil, fmt.Errorf("%w: non-minimal frame length", ErrWebSocketProtocolError)
+		}
+	}
+
+	if opcode >= WebSocketCloseMessage && (length > 125 || !fin) {
+		return false, false, 0, nil, fmt.Errorf("%w: invalid control frame", ErrWebSocketProtocolError)
+	}
+	if length > uint64(c.maxMessageSize) {
+		return false, false, 0, nil, ErrWebSocketMessageTooBig
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+		return false, false, 0, nil, err
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return false, false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, rsv1, opcode, payload, nil
+}
+
+func (c *WebSocketConn) writeFrame(opcode WebSocketMessageType, payload []byte, rsv1 bool) error {
+	c.writeMux.Lock()
+	defer c.writeMux.Unlock()
+
+	header := make([]byte, 0, 10)
+	b0 := byte(0x80) | byte(opcode)
+	if rsv1 {
+		b0 |= 0x40
+	}
+	header = append(header, b0)
+
+	switch length := len(payload); {
+	case length <= 125:
+		header = append(header, byte(length))
+	case length <= 0xffff:
+		header = append(header, 126)
+		header = binary.BigEndian.AppendUint16(header, uint16(length))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(length))
+	}
+
+	buffers := net.Buffers{header, payload}
+	_, err := buffers.WriteTo(c.conn)
+	return err
+}
+
+func (c *WebSocketConn) inflate(data []byte) ([]byte, error) {
+	fr := flate.NewReader(io.MultiReader(bytes.NewReader(data), bytes.NewReader(deflateTail)))
+	defer fr.Close()
+
+	message, err := io.ReadAll(io.LimitReader(fr, c.maxMessageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(message)) > c.maxMessageSize {
+		return nil, ErrWebSocketMessageTooBig
+	}
+	return message, nil
+}
+
+func acceptsPerMessageDeflate(h http.Header) bool {
+	for _, offer := range headerTokens(h, "Sec-WebSocket-Extensions") {
+		params := strings.Split(offer, ";")
+		if strings.TrimSpace(params[0]) != "permessage-deflate" {
+			continue
+		}
+
+		// The compressor always uses a 32K window, offers restricting the server window cannot be accepted
+		acceptable := true
+		for _, p := range params[1:] {
+			name, value, _ := strings.Cut(strings.TrimSpace(p), "=")
+			if name == "server_max_window_bits" && strings.Trim(value, `"`) != "15" {
+				acceptable = false
+			}
+		}
+		if acceptable {
+			return true
+		}
+	}
+	return false
+}
+
+func headerContainsToken(h http.Header, name string, token string) bool {
+	for _, t := range headerTokens(h, name) {
+		if strings.EqualFold(t, token) {
+			return true
+		}
+	}
+	return false
+}
+
+func headerTokens(h http.Header, name string) []string {
+	tokens := make([]string, 0)
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				tokens = append(tokens, t)
+			}
+		}
+	}
+	return tokens
+}
+
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+func webSocketAccept(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + webSocketGuid))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,274 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebSocketAccept(t *testing.T) {
+	// Example from RFC 6455 section 1.3
+	if got := webSocketAccept("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("webSocketAccept() = %s", got)
+	}
+}
+
+func TestWebSocketConn_ReadMessage(t *testing.T) {
+	tests := []struct {
+		name      string
+		frame     []byte
+		message   string
+		err       error
+		closeCode int
+	}{
+		{
+			name:    "text message",
+			frame:   clientFrame(0x81, lengthPrefix(5), []byte("hello")),
+			message: "hello",
+		},
+		{
+			name:      "16 bit length below 126",
+			frame:     clientFrame(0x81, []byte{126, 0, 5}, []byte("hello")),
+			err:       ErrWebSocketProtocolError,
+			closeCode: WebSocketCloseProtocolError,
+		},
+		{
+			name:      "64 bit length below 65536",
+			frame:     clientFrame(0x81, append([]byte{127}, binary.BigEndian.AppendUint64(nil, 5)...), []byte("hello")),
+			err:       ErrWebSocketProtocolError,
+			closeCode: WebSocketCloseProtocolError,
+		},
+		{
+			name:      "64 bit length with most significant bit set",
+			frame:     clientFrame(0x82, append([]byte{127}, binary.BigEndian.AppendUint64(nil, 1<<63|1<<20)...), nil),
+			err:       ErrWebSocketProtocolError,
+			closeCode: WebSocketCloseProtocolError,
+		},
+		{
+			name:      "huge length without configured limit",
+			frame:     clientFrame(0x82, append([]byte{127}, binary.BigEndian.AppendUint64(nil, 1<<40)...), nil),
+			err:       ErrWebSocketMessageTooBig,
+			closeCode: WebSocketCloseMessageTooBig,
+		},
+		{
+			name:      "close frame with one byte payload",
+			frame:     clientFrame(0x88, lengthPrefix(1), []byte{0x03}),
+			err:       ErrWebSocketProtocolError,
+			closeCode: WebSocketCloseProtocolError,
+		},
+		{
+			name:      "close frame with status",
+			frame:     clientFrame(0x88, lengthPrefix(2), binary.BigEndian.AppendUint16(nil, WebSocketCloseNormalClosure)),
+			err:       &WebSocketCloseError{Code: WebSocketCloseNormalClosure},
+			closeCode: WebSocketCloseNormalClosure,
+		},
+		{
+			name:      "close frame with reserved status",
+			frame:     clientFrame(0x88, lengthPrefix(2), binary.BigEndian.AppendUint16(nil, WebSocketCloseAbnormalClosure)),
+			err:       ErrWebSocketProtocolError,
+			closeCode: WebSocketCloseProtocolError,
+		},
+		{
+			name:      "close frame with status below 1000",
+			frame:     clientFrame(0x88, lengthPrefix(2), binary.BigEndian.AppendUint16(nil, 999)),
+			err:       ErrWebSocketProtocolError,
+			closeCode: WebSocketCloseProtocolError,
+		},
+		{
+			name:      "close frame with invalid utf-8 reason",
+			frame:     clientFrame(0x88, lengthPrefix(4), append(binary.BigEndian.AppendUint16(nil, WebSocketCloseNormalClosure), 0xff, 0xfe)),
+			err:       ErrWebSocketInvalidPayload,
+			closeCode: WebSocketCloseInvalidPayloadData,
+		},
+		{
+			name:      "text message with invalid utf-8",
+			frame:     clientFrame(0x81, lengthPrefix(2), []byte{0xff, 0xfe}),
+			err:       ErrWebSocketInvalidPayload,
+			closeCode: WebSocketCloseInvalidPayloadData,
+		},
+		{
+			name:      "unmasked frame",
+			frame:     []byte{0x81, 0x01, 'a'},
+			err:       ErrWebSocketProtocolError,
+			closeCode: WebSocketCloseProtocolError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			type result struct {
+				message []byte
+				err     error
+			}
+			results := make(chan result, 1)
+
+			u := NewWebSocketUpgrader()
+			u.MaxMessageSize = 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				c, err := u.Upgrade(w, r, nil)
+				if err != nil {
+					results <- result{err: err}
+					return
+				}
+				_, message, err := c.ReadMessage()
+				results <- result{message: message, err: err}
+			}))
+			defer srv.Close()
+
+			conn, reader := dialWebSocket(t, srv)
+			defer conn.Close()
+			if _, err := conn.Write(tt.frame); err != nil {
+				t.Fatal(err)
+			}
+
+			var r result
+			select {
+			case r = <-results:
+			case <-time.After(5 * time.Second):
+				t.Fatal("ReadMessage did not return")
+			}
+
+			switch expected := tt.err.(type) {
+			case nil:
+				if r.err != nil || string(r.message) != tt.message {
+					t.Fatalf("ReadMessage() = %q, %v, want %q", r.message, r.err, tt.message)
+				}
+			case *WebSocketCloseError:
+				var closeErr *WebSocketCloseError
+				if !errors.As(r.err, &closeErr) || closeErr.Code != expected.Code {
+					t.Fatalf("ReadMessage() error = %v, want close code %d", r.err, expected.Code)
+				}
+			default:
+				if !errors.Is(r.err, tt.err) {
+					t.Fatalf("ReadMessage() error = %v, want %v", r.err, tt.err)
+				}
+			}
+
+			if tt.closeCode != 0 {
+				if code := readCloseCode(t, conn, reader); code != tt.closeCode {
+					t.Errorf("close code = %d, want %d", code, tt.closeCode)
+				}
+			}
+		})
+	}
+}
+
+func dialWebSocket(t *testing.T, srv *httptest.Server) (net.Conn, *bufio.Reader) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	request := "GET / HTTP/1.1\r\nHost: " + conn.RemoteAddr().String() + "\r\n" +
+		"Connection: Upgrade\r\nUpgrade: websocket\r\nSec-WebSocket-Version: 13\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n"
+	if _, err = io.WriteString(conn, request); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := bufio.NewReader(conn)
+	res, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("handshake status = %d", res.StatusCode)
+	}
+	return conn, reader
+}
+
+// readCloseCode reads the close frame sent by the server
+func readCloseCode(t *testing.T, conn net.Conn, reader *bufio.Reader) int {
+	t.Helper()
+
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		t.Fatal(err)
+	}
+	if WebSocketMessageType(header[0]&0x0f) != WebSocketCloseMessage {
+		t.Fatalf("opcode = %d, want close", header[0]&0x0f)
+	}
+	payload := make([]byte, header[1]&0x7f)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		t.Fatal(err)
+	}
+	if len(payload) < 2 {
+		return WebSocketCloseNoStatusReceived
+	}
+	return int(binary.BigEndian.Uint16(payload))
+}
+
+func lengthPrefix(length byte) []byte {
+	return []byte{0x80 | length}
+}
+
+// clientFrame builds a masked frame, the mask bit is set on the first length byte
+func clientFrame(b0 byte, length []byte, payload []byte) []byte {
+	mask := []byte{0x12, 0x34, 0x56, 0x78}
+	length[0] |= 0x80
+
+	frame := append([]byte{b0}, length...)
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	return frame
+}
+
+func TestTruncateCloseReason(t *testing.T) {
+	tests := []struct {
+		name   string
+		reason string
+		want   string
+	}{
+		{
+			name:   "short reason",
+			reason: "bye",
+			want:   "bye",
+		},
+		{
+			name:   "ascii reason",
+			reason: strings.Repeat("a", 130),
+			want:   strings.Repeat("a", 123),
+		},
+		{
+			name:   "multibyte rune on the boundary",
+			reason: strings.Repeat("a", 122) + "é",
+			want:   strings.Repeat("a", 122),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := truncateCloseReason(tt.reason); got != tt.want {
+				t.Errorf("truncateCloseReason() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
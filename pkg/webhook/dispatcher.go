@@ -0,0 +1,412 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math"
+	mathrand "math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/corelayer/go-kit/pkg/client"
+)
+
+type DispatcherOptions struct {
+	Workers      int
+	MaxAttempts  int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	PollInterval time.Duration
+	// Retention is the time delivered and failed deliveries are kept in the store after their last attempt
+	Retention time.Duration
+}
+
+func DefaultDispatcherOptions() DispatcherOptions {
+	return DispatcherOptions{
+		Workers:      4,
+		MaxAttempts:  8,
+		BaseDelay:    5 * time.Second,
+		MaxDelay:     time.Hour,
+		PollInterval: time.Second,
+		Retention:    24 * time.Hour,
+	}
+}
+
+// NewDispatcher creates a dispatcher delivering signed webhooks, a client without redirects is used when c is nil.
+// Zero values in o are replaced by their defaults.
+func NewDispatcher(c *http.Client, signer *Signer, store DeliveryStore, o DispatcherOptions) *Dispatcher {
+	if c == nil {
+		c = client.NewHttpClient("go-kit-webhook", 30, false)
+	}
+
+	defaults := DefaultDispatcherOptions()
+	if o.Workers <= 0 {
+		o.Workers = defaults.Workers
+	}
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = defaults.MaxAttempts
+	}
+	if o.BaseDelay <= 0 {
+		o.BaseDelay = defaults.BaseDelay
+	}
+	if o.MaxDelay <= 0 {
+		o.MaxDelay = defaults.MaxDelay
+	}
+	if o.PollInterval <= 0 {
+		o.PollInterval = defaults.PollInterval
+	}
+	if o.Retention <= 0 {
+		o.Retention = defaults.Retention
+	}
+	return &Dispatcher{
+		client:    c,
+		signer:    signer,
+		store:     store,
+		options:   o,
+		scheduled: make(map[string]time.Time),
+		inflight:  make(map[string]struct{}),
+		retries:   make(map[string]struct{}),
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+// deliveryCleanupInterval is the interval at which Run reads the store to remove expired deliveries
+const deliveryCleanupInterval = time.Minute
+
+type Dispatcher struct {
+	client  *http.Client
+	signer  *Signer
+	store   DeliveryStore
+	options DispatcherOptions
+	// scheduled holds the next attempt of every pending delivery, so the store is not read on every poll
+	scheduled map[string]time.Time
+	inflight  map[string]struct{}
+	// retries holds deliveries which were retried while in flight, they are scheduled again once the attempt completes
+	retries map[string]struct{}
+	wake    chan struct{}
+	mux     sync.Mutex
+}
+
+type envelope struct {
+	Type      string    `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	Data      any       `json:"data"`
+}
+
+// Enqueue persists a delivery of data to endpoint, it is sent by Run
+func (d *Dispatcher) Enqueue(endpoint string, eventType string, data any) (Delivery, error) {
+	now := time.Now().UTC()
+	body, err := json.Marshal(envelope{
+		Type:      eventType,
+		Timestamp: now,
+		Data:      data,
+	})
+	if err != nil {
+		return Delivery{}, err
+	}
+
+	delivery := Delivery{
+		Id:          newDeliveryId(),
+		Endpoint:    endpoint,
+		EventType:   eventType,
+		Body:        body,
+		State:       DeliveryPending,
+		Created:     now,
+		NextAttempt: now,
+	}
+	if err = d.store.Save(delivery); err != nil {
+		return Delivery{}, err
+	}
+
+	d.schedule(delivery.Id, delivery.NextAttempt)
+	return delivery, nil
+}
+
+func (d *Dispatcher) Deliveries() ([]Delivery, error) {
+	return d.store.List()
+}
+
+func (d *Dispatcher) Delivery(id string) (Delivery, error) {
+	return d.store.Load(id)
+}
+
+// Retry schedules a failed delivery for immediate redelivery.
+// A delivery which is being sent is scheduled again once the attempt completes, unless it succeeds.
+func (d *Dispatcher) Retry(id string) error {
+	// The lock is held while saving, so an attempt which completes concurrently cannot overwrite the retry
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	if _, found := d.inflight[id]; found {
+		d.retries[id] = struct{}{}
+		return nil
+	}
+
+	delivery, err := d.store.Load(id)
+	if err != nil {
+		return err
+	}
+	delivery.State = DeliveryPending
+	delivery.NextAttempt = time.Now().UTC()
+	if err = d.store.Save(delivery); err != nil {
+		return err
+	}
+
+	d.scheduled[id] = delivery.NextAttempt
+	d.notify()
+	return nil
+}
+
+// Run delivers pending webhooks until ctx is cancelled, deliveries persisted by a previous run are picked up as well.
+// Delivered and failed deliveries are removed from the store once they exceed the retention.
+func (d *Dispatcher) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	slots := make(chan struct{}, d.options.Workers)
+	ticker := time.NewTicker(d.options.PollInterval)
+	defer ticker.Stop()
+
+	var lastCleanup time.Time
+	for {
+		now := time.Now()
+		if now.Sub(lastCleanup) >= deliveryCleanupInterval {
+			d.sweep(now)
+			lastCleanup = now
+		}
+
+		for _, id := range d.due(now) {
+			if !d.claim(id) {
+				continue
+			}
+			delivery, err := d.store.Load(id)
+			if err != nil || delivery.State != DeliveryPending {
+				if err != nil {
+					slog.Error("could not load webhook delivery", "id", id, "error", err)
+				}
+				d.unschedule(id)
+				d.release(id)
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				d.release(delivery.Id)
+				return ctx.Err()
+			case slots <- struct{}{}:
+			}
+
+			wg.Add(1)
+			go func(delivery Delivery) {
+				defer wg.Done()
+				defer func() { <-slots }()
+				defer d.release(delivery.Id)
+				d.deliver(ctx, delivery)
+			}(delivery)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, delivery Delivery) {
+	start := time.Now()
+	attempt := Attempt{Time: start.UTC()}
+
+	statusCode, err := d.send(ctx, delivery)
+	attempt.Duration = time.Since(start)
+	attempt.StatusCode = statusCode
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+
+	// Do not record attempts interrupted by a shutdown
+	if ctx.Err() != nil {
+		return
+	}
+
+	delivery.Attempts = append(delivery.Attempts, attempt)
+	switch {
+	case err == nil && statusCode >= 200 && statusCode < 300:
+		delivery.State = DeliveryDelivered
+	case statusCode == http.StatusGone || len(delivery.Attempts) >= d.options.MaxAttempts:
+		delivery.State = DeliveryFailed
+		slog.Warn("webhook delivery failed", "id", delivery.Id, "endpoint", delivery.Endpoint, "attempts", len(delivery.Attempts))
+	default:
+		delivery.NextAttempt = time.Now().UTC().Add(d.backoff(len(delivery.Attempts)))
+	}
+
+	// Saving and releasing the delivery under the lock makes a concurrent Retry either apply here or after the save
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	if _, retry := d.retries[delivery.Id]; retry && delivery.State != DeliveryDelivered {
+		delivery.State = DeliveryPending
+		delivery.NextAttempt = time.Now().UTC()
+	}
+	delete(d.retries, delivery.Id)
+	if delivery.State == DeliveryPending {
+		d.scheduled[delivery.Id] = delivery.NextAttempt
+	} else {
+		delete(d.scheduled, delivery.Id)
+	}
+
+	if err = d.store.Save(delivery); err != nil {
+		slog.Error("could not save webhook delivery", "id", delivery.Id, "error", err)
+	}
+	delete(d.inflight, delivery.Id)
+}
+
+func (d *Dispatcher) send(ctx context.Context, delivery Delivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.Endpoint, bytes.NewReader(delivery.Body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	d.signer.SetHeaders(req.Header, delivery.Id, time.Now(), delivery.Body)
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64*1024))
+	return res.StatusCode, nil
+}
+
+// backoff returns an exponential delay with jitter for the given number of attempts
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := float64(d.options.BaseDelay) * math.Pow(2, float64(attempts-1))
+	if delay > float64(d.options.MaxDelay) {
+		delay = float64(d.options.MaxDelay)
+	}
+	return time.Duration(delay/2 + mathrand.Float64()*delay/2)
+}
+
+// expired reports whether a finished delivery has been kept longer than the retention
+func (d *Dispatcher) expired(delivery Delivery, now time.Time) bool {
+	if delivery.State == DeliveryPending {
+		return false
+	}
+	finished := delivery.Created
+	if len(delivery.Attempts) > 0 {
+		finished = delivery.Attempts[len(delivery.Attempts)-1].Time
+	}
+	return now.Sub(finished) > d.options.Retention
+}
+
+// sweep removes expired deliveries from the store and schedules all pending deliveries, including those persisted by
+// a previous run
+func (d *Dispatcher) sweep(now time.Time) {
+	deliveries, err := d.store.List()
+	if err != nil {
+		slog.Error("could not list webhook deliveries", "error", err)
+		return
+	}
+
+	for _, delivery := range deliveries {
+		switch {
+		case d.expired(delivery, now):
+			if err = d.store.Delete(delivery.Id); err != nil {
+				slog.Error("could not delete webhook delivery", "id", delivery.Id, "error", err)
+			}
+		case delivery.State == DeliveryPending:
+			d.mux.Lock()
+			if _, found := d.scheduled[delivery.Id]; !found {
+				d.scheduled[delivery.Id] = delivery.NextAttempt
+			}
+			d.mux.Unlock()
+		}
+	}
+}
+
+// schedule plans the next attempt of a delivery and wakes up Run
+func (d *Dispatcher) schedule(id string, next time.Time) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	d.scheduled[id] = next
+	d.notify()
+}
+
+func (d *Dispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (d *Dispatcher) unschedule(id string) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	delete(d.scheduled, id)
+}
+
+// due returns the scheduled deliveries of which the next attempt has passed, ordered by that attempt
+func (d *Dispatcher) due(now time.Time) []string {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	output := make([]string, 0)
+	for id, next := range d.scheduled {
+		if !next.After(now) {
+			output = append(output, id)
+		}
+	}
+	sort.Slice(output, func(i, j int) bool {
+		return d.scheduled[output[i]].Before(d.scheduled[output[j]])
+	})
+	return output
+}
+
+func (d *Dispatcher) claim(id string) bool {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	if _, found := d.inflight[id]; found {
+		return false
+	}
+	d.inflight[id] = struct{}{}
+	return true
+}
+
+func (d *Dispatcher) release(id string) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	delete(d.inflight, id)
+}
+
+func newDeliveryId() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
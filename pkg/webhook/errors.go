@@ -0,0 +1,73 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package webhook
+
+const (
+	ErrDeliveryNotFoundMessage    = "webhook delivery not found"
+	ErrHeadersMissingMessage      = "webhook headers missing"
+	ErrSecretInvalidMessage       = "webhook secret is invalid"
+	ErrSignatureInvalidMessage    = "webhook signature is invalid"
+	ErrTimestampOutOfRangeMessage = "webhook timestamp out of tolerance"
+)
+
+var (
+	ErrDeliveryNotFound    = DeliveryNotFoundError{message: ErrDeliveryNotFoundMessage}
+	ErrHeadersMissing      = HeadersMissingError{message: ErrHeadersMissingMessage}
+	ErrSecretInvalid       = SecretInvalidError{message: ErrSecretInvalidMessage}
+	ErrSignatureInvalid    = SignatureInvalidError{message: ErrSignatureInvalidMessage}
+	ErrTimestampOutOfRange = TimestampOutOfRangeError{message: ErrTimestampOutOfRangeMessage}
+)
+
+type DeliveryNotFoundError struct {
+	message string
+}
+
+func (e DeliveryNotFoundError) Error() string {
+	return e.message
+}
+
+type HeadersMissingError struct {
+	message string
+}
+
+func (e HeadersMissingError) Error() string {
+	return e.message
+}
+
+type SecretInvalidError struct {
+	message string
+}
+
+func (e SecretInvalidError) Error() string {
+	return e.message
+}
+
+type SignatureInvalidError struct {
+	message string
+}
+
+func (e SignatureInvalidError) Error() string {
+	return e.message
+}
+
+type TimestampOutOfRangeError struct {
+	message string
+}
+
+func (e TimestampOutOfRangeError) Error() string {
+	return e.message
+}
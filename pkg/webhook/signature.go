@@ -0,0 +1,127 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Header names as defined by the Standard Webhooks specification
+const (
+	HeaderId        = "webhook-id"
+	HeaderTimestamp = "webhook-timestamp"
+	HeaderSignature = "webhook-signature"
+)
+
+const secretPrefix = "whsec_"
+
+// DefaultTolerance is the maximum age of a message accepted by a Verifier created with a zero tolerance
+const DefaultTolerance = 5 * time.Minute
+
+// NewSigner creates a signer for a Standard Webhooks secret, base64 encoded key material with an optional "whsec_" prefix
+func NewSigner(secret string) (*Signer, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(secret, secretPrefix))
+	if err != nil {
+		return nil, ErrSecretInvalid
+	}
+	if len(key) < 24 {
+		return nil, ErrSecretInvalid
+	}
+	return &Signer{key: key}, nil
+}
+
+type Signer struct {
+	key []byte
+}
+
+// Sign returns the signature header value for a message, "v1," followed by the base64 encoded HMAC-SHA256
+func (s *Signer) Sign(id string, timestamp time.Time, payload []byte) string {
+	h := hmac.New(sha256.New, s.key)
+	h.Write([]byte(id + "." + strconv.FormatInt(timestamp.Unix(), 10) + "."))
+	h.Write(payload)
+	return "v1," + base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// SetHeaders adds the webhook id, timestamp and signature headers to h
+func (s *Signer) SetHeaders(h http.Header, id string, timestamp time.Time, payload []byte) {
+	h.Set(HeaderId, id)
+	h.Set(HeaderTimestamp, strconv.FormatInt(timestamp.Unix(), 10))
+	h.Set(HeaderSignature, s.Sign(id, timestamp, payload))
+}
+
+// NewVerifier creates a verifier accepting signatures made with any of the secrets, allowing secrets to be rotated.
+// Messages with a timestamp further than tolerance from the current time are rejected to prevent replay attacks,
+// DefaultTolerance is used when tolerance is zero.
+func NewVerifier(tolerance time.Duration, secrets ...string) (*Verifier, error) {
+	if tolerance <= 0 {
+		tolerance = DefaultTolerance
+	}
+	v := &Verifier{
+		tolerance: tolerance,
+		signers:   make([]*Signer, 0, len(secrets)),
+	}
+	for _, secret := range secrets {
+		s, err := NewSigner(secret)
+		if err != nil {
+			return nil, err
+		}
+		v.signers = append(v.signers, s)
+	}
+	if len(v.signers) == 0 {
+		return nil, ErrSecretInvalid
+	}
+	return v, nil
+}
+
+type Verifier struct {
+	tolerance time.Duration
+	signers   []*Signer
+}
+
+func (v *Verifier) Verify(h http.Header, payload []byte) error {
+	id := h.Get(HeaderId)
+	timestamp := h.Get(HeaderTimestamp)
+	signatures := h.Get(HeaderSignature)
+	if id == "" || timestamp == "" || signatures == "" {
+		return ErrHeadersMissing
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrTimestampOutOfRange
+	}
+	t := time.Unix(seconds, 0)
+	if time.Since(t) > v.tolerance || time.Until(t) > v.tolerance {
+		return ErrTimestampOutOfRange
+	}
+
+	for _, s := range v.signers {
+		expected := s.Sign(id, t, payload)
+		for _, signature := range strings.Fields(signatures) {
+			if hmac.Equal([]byte(signature), []byte(expected)) {
+				return nil
+			}
+		}
+	}
+	return ErrSignatureInvalid
+}
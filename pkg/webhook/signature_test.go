@@ -0,0 +1,169 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+package webhook
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestNewSigner(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+
+	tests := []struct {
+		name   string
+		secret string
+		err    error
+	}{
+		{
+			name:   "prefixed secret",
+			secret: "whsec_" + key,
+		},
+		{
+			name:   "secret without prefix",
+			secret: key,
+		},
+		{
+			name:   "secret which is not base64 encoded",
+			secret: "whsec_" + "not base64 encoded at all!",
+			err:    ErrSecretInvalid,
+		},
+		{
+			name:   "short key",
+			secret: "whsec_" + base64.StdEncoding.EncodeToString([]byte("short")),
+			err:    ErrSecretInvalid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewSigner(tt.secret); !errors.Is(err, tt.err) {
+				t.Errorf("NewSigner() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	current := "whsec_" + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	previous := "whsec_" + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32))
+	unknown := "whsec_" + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{3}, 32))
+	payload := []byte(`{"type":"test"}`)
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp time.Time
+		payload   []byte
+		err       error
+	}{
+		{
+			name:      "current secret",
+			secret:    current,
+			timestamp: time.Now(),
+			payload:   payload,
+		},
+		{
+			name:      "rotated secret",
+			secret:    previous,
+			timestamp: time.Now(),
+			payload:   payload,
+		},
+		{
+			name:      "unknown secret",
+			secret:    unknown,
+			timestamp: time.Now(),
+			payload:   payload,
+			err:       ErrSignatureInvalid,
+		},
+		{
+			name:      "modified payload",
+			secret:    current,
+			timestamp: time.Now(),
+			payload:   []byte(`{"type":"modified"}`),
+			err:       ErrSignatureInvalid,
+		},
+		{
+			name:      "timestamp within the default tolerance",
+			secret:    current,
+			timestamp: time.Now().Add(-4 * time.Minute),
+			payload:   payload,
+		},
+		{
+			name:      "timestamp too old",
+			secret:    current,
+			timestamp: time.Now().Add(-DefaultTolerance - time.Minute),
+			payload:   payload,
+			err:       ErrTimestampOutOfRange,
+		},
+		{
+			name:      "timestamp too far in the future",
+			secret:    current,
+			timestamp: time.Now().Add(DefaultTolerance + time.Minute),
+			payload:   payload,
+			err:       ErrTimestampOutOfRange,
+		},
+	}
+
+	v, err := NewVerifier(0, current, previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewSigner(tt.secret)
+			if err != nil {
+				t.Fatal(err)
+			}
+			h := make(http.Header)
+			s.SetHeaders(h, "msg_1", tt.timestamp, payload)
+
+			if err = v.Verify(h, tt.payload); !errors.Is(err, tt.err) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestVerifier_VerifyMultipleSignatures(t *testing.T) {
+	current := "whsec_" + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	next := "whsec_" + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32))
+	payload := []byte(`{"type":"test"}`)
+
+	v, err := NewVerifier(time.Minute, current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	currentSigner, _ := NewSigner(current)
+	nextSigner, _ := NewSigner(next)
+
+	// A sender rotating its secret signs with both the next and the current secret
+	now := time.Now()
+	h := make(http.Header)
+	h.Set(HeaderId, "msg_1")
+	h.Set(HeaderTimestamp, strconv.FormatInt(now.Unix(), 10))
+	h.Set(HeaderSignature, nextSigner.Sign("msg_1", now, payload)+" "+currentSigner.Sign("msg_1", now, payload))
+
+	if err = v.Verify(h, payload); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+}
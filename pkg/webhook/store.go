@@ -0,0 +1,97 @@
+/*
+ * Copyright 2024 CoreLayer BV
+ *
+ *    Licensed under the Apache License, Version 2.0 (the "License");
+ *    you may not use this file except in compliance with the License.
+ *    You may obtain a copy of the License at
+ *
+ *        http://www.apache.org/licenses/LICENSE-2.0
+ *
+ *    Unless required by applicable law or agreed to in writing, software
+ *    distributed under the License is distributed on an "AS IS" BASIS,
+ *    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ *    See the License for the specific language governing permissions and
+ *    limitations under the License.
+ */
+
+package webhook
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/corelayer/go-kit/pkg/internal/filestore"
+)
+
+type DeliveryState string
+
+const (
+	DeliveryPending   DeliveryState = "pending"
+	DeliveryDelivered DeliveryState = "delivered"
+	DeliveryFailed    DeliveryState = "failed"
+)
+
+type Delivery struct {
+	Id          string          `json:"id"`
+	Endpoint    string          `json:"endpoint"`
+	EventType   string          `json:"eventType"`
+	Body        json.RawMessage `json:"body"`
+	State       DeliveryState   `json:"state"`
+	Attempts    []Attempt       `json:"attempts,omitempty"`
+	Created     time.Time       `json:"created"`
+	NextAttempt time.Time       `json:"nextAttempt"`
+}
+
+type Attempt struct {
+	Time       time.Time     `json:"time"`
+	StatusCode int           `json:"statusCode,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	Duration   time.Duration `json:"duration"`
+}
+
+type DeliveryStore interface {
+	Save(d Delivery) error
+	Load(id string) (Delivery, error)
+	List() ([]Delivery, error)
+	Delete(id string) error
+}
+
+// NewFileDeliveryStore creates a store persisting every delivery as a JSON file in path
+func NewFileDeliveryStore(path string) (*FileDeliveryStore, error) {
+	files, err := filestore.New[Delivery](path, ".delivery", ErrDeliveryNotFound)
+	if err != nil {
+		return nil, err
+	}
+	return &FileDeliveryStore{
+		files: files,
+	}, nil
+}
+
+type FileDeliveryStore struct {
+	files *filestore.Store[Delivery]
+}
+
+func (f *FileDeliveryStore) Save(d Delivery) error {
+	return f.files.Save(d.Id, d)
+}
+
+func (f *FileDeliveryStore) Load(id string) (Delivery, error) {
+	return f.files.Load(id)
+}
+
+// List returns all deliveries ordered by creation time
+func (f *FileDeliveryStore) List() ([]Delivery, error) {
+	output, err := f.files.List()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(output, func(i, j int) bool {
+		return output[i].Created.Before(output[j].Created)
+	})
+	return output, nil
+}
+
+func (f *FileDeliveryStore) Delete(id string) error {
+	return f.files.Delete(id)
+}